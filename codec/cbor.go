@@ -0,0 +1,21 @@
+package codec
+
+import "github.com/fxamacker/cbor/v2"
+
+//CBORCodec encodes messages with cbor, []byte fields travel as byte strings
+type CBORCodec struct{}
+
+//Name is the wire name of the encoding
+func (CBORCodec) Name() string {
+	return "cbor"
+}
+
+//Marshal encodes the value
+func (CBORCodec) Marshal(v interface{}) ([]byte, error) {
+	return cbor.Marshal(v)
+}
+
+//Unmarshal decodes the data into the value
+func (CBORCodec) Unmarshal(data []byte, v interface{}) error {
+	return cbor.Unmarshal(data, v)
+}
@@ -0,0 +1,33 @@
+package codec
+
+import "fmt"
+
+//Codec encodes and decodes the MTSMessage envelope and its payloads on the wire
+type Codec interface {
+	//Name is the wire name of the encoding
+	Name() string
+	//Marshal encodes the value
+	Marshal(v interface{}) ([]byte, error)
+	//Unmarshal decodes the data into the value
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	//JSON is the default codec the MTS server speaks
+	JSON Codec = JSONCodec{}
+	//MessagePack is the msgpack codec for the newer server builds
+	MessagePack Codec = MessagePackCodec{}
+	//CBOR is the cbor codec for the newer server builds
+	CBOR Codec = CBORCodec{}
+)
+
+//ByName returns the codec registered under the wire name
+func ByName(name string) (Codec, error) {
+	for _, codec := range []Codec{JSON, MessagePack, CBOR} {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown codec: %s", name)
+}
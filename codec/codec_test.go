@@ -0,0 +1,78 @@
+package codec
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//allByteValues covers every byte value, including the ones that are not valid UTF-8
+func allByteValues() []byte {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	return data
+}
+
+func TestCodecsRoundTripByteFields(t *testing.T) {
+	byteFields := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "nil", value: nil},
+		{name: "empty", value: []byte{}},
+		{name: "binary", value: allByteValues()},
+	}
+
+	for _, codec := range []Codec{JSON, MessagePack, CBOR} {
+		for _, field := range byteFields {
+			t.Run(codec.Name()+"/"+field.name, func(t *testing.T) {
+				attributeRoute := "attribute"
+				jwt := "token"
+				message := model.MTSMessage{
+					Version:        1,
+					AttributeRoute: &attributeRoute,
+					Route:          enum.OPL,
+					SrcID:          2,
+					DstID:          1,
+					RPCID:          42,
+					JWT:            &jwt,
+					Data:           field.value,
+				}
+				assertRoundTrip(t, codec, &message, &model.MTSMessage{})
+
+				login := model.MtsLogin{
+					AppID:             enum.RMSServer,
+					AppKey:            field.value,
+					ClientCertificate: field.value,
+					MinVersion:        1,
+					MaxVersion:        1,
+				}
+				assertRoundTrip(t, codec, &login, &model.MtsLogin{})
+
+				loginResponse := model.MtsLoginResponse{ClientCertificate: field.value, MtuMts: 1 << 16}
+				assertRoundTrip(t, codec, &loginResponse, &model.MtsLoginResponse{})
+			})
+		}
+	}
+}
+
+func assertRoundTrip(t *testing.T, codec Codec, value interface{}, decoded interface{}) {
+	t.Helper()
+	data, err := codec.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshal %T: %v", value, err)
+	}
+
+	if err = codec.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("unmarshal %T: %v", value, err)
+	}
+
+	if !reflect.DeepEqual(value, decoded) {
+		t.Fatalf("%T changed in the round trip\nsent     %+v\nreceived %+v", value, value, decoded)
+	}
+}
@@ -0,0 +1,21 @@
+package codec
+
+import "encoding/json"
+
+//JSONCodec encodes messages with encoding/json, []byte fields travel as base64 strings
+type JSONCodec struct{}
+
+//Name is the wire name of the encoding
+func (JSONCodec) Name() string {
+	return "json"
+}
+
+//Marshal encodes the value
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+//Unmarshal decodes the data into the value
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,37 @@
+package codec
+
+import (
+	"bytes"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+//structTag keeps the binary field names identical to the json ones
+const structTag = "json"
+
+//MessagePackCodec encodes messages with msgpack, []byte fields travel as bin
+type MessagePackCodec struct{}
+
+//Name is the wire name of the encoding
+func (MessagePackCodec) Name() string {
+	return "msgpack"
+}
+
+//Marshal encodes the value
+func (MessagePackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buff bytes.Buffer
+	encoder := msgpack.NewEncoder(&buff)
+	encoder.SetCustomStructTag(structTag)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+//Unmarshal decodes the data into the value
+func (MessagePackCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag(structTag)
+	return decoder.Decode(v)
+}
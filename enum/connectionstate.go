@@ -0,0 +1,26 @@
+package enum
+
+//ConnectionState is the enum published by the reconnect supervisor
+type ConnectionState int
+
+const (
+	//Connecting is the first dial and login
+	Connecting = 1
+	//Connected is an authenticated session
+	Connected = 2
+	//Reconnecting is a redial after a transient failure
+	Reconnecting = 3
+	//Failed is a permanent failure or an exhausted retry budget
+	Failed = 4
+)
+
+func (v ConnectionState) String() string {
+	dictMap := map[ConnectionState]string{
+		1: "Connecting",
+		2: "Connected",
+		3: "Reconnecting",
+		4: "Failed",
+	}
+
+	return dictMap[v]
+}
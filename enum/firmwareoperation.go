@@ -0,0 +1,23 @@
+package enum
+
+//FirmwareOperation is the enum for the chunked transfer messages on the Firmware route
+type FirmwareOperation int
+
+const (
+	//FirmwareUploadChunk carries one chunk of an upload
+	FirmwareUploadChunk = 1
+	//FirmwareResume asks for the offset acknowledged so far
+	FirmwareResume = 2
+	//FirmwareDownloadChunk asks for the chunk at an offset
+	FirmwareDownloadChunk = 3
+)
+
+func (v FirmwareOperation) String() string {
+	dictMap := map[FirmwareOperation]string{
+		1: "FirmwareUploadChunk",
+		2: "FirmwareResume",
+		3: "FirmwareDownloadChunk",
+	}
+
+	return dictMap[v]
+}
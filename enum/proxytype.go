@@ -0,0 +1,23 @@
+package enum
+
+//ProxyType is the enum for the proxy protocol in front of the MTS server
+type ProxyType int
+
+const (
+	//NoProxy dials the MTS server directly
+	NoProxy = 0
+	//HTTPConnect tunnels through an HTTP CONNECT proxy
+	HTTPConnect = 1
+	//SOCKS5 tunnels through a SOCKS5 proxy
+	SOCKS5 = 2
+)
+
+func (v ProxyType) String() string {
+	dictMap := map[ProxyType]string{
+		0: "NoProxy",
+		1: "HTTPConnect",
+		2: "SOCKS5",
+	}
+
+	return dictMap[v]
+}
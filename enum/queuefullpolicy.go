@@ -0,0 +1,23 @@
+package enum
+
+//QueueFullPolicy is the enum for what a send does when the outbound queue is full
+type QueueFullPolicy int
+
+const (
+	//BlockWhenFull waits for space until the send context is done
+	BlockWhenFull = 0
+	//FailWhenFull rejects the send with ErrQueueFull
+	FailWhenFull = 1
+	//DropOldestWhenFull evicts the oldest queued message to make room
+	DropOldestWhenFull = 2
+)
+
+func (v QueueFullPolicy) String() string {
+	dictMap := map[QueueFullPolicy]string{
+		0: "BlockWhenFull",
+		1: "FailWhenFull",
+		2: "DropOldestWhenFull",
+	}
+
+	return dictMap[v]
+}
@@ -0,0 +1,26 @@
+package enum
+
+//SendPriority is the enum for the outbound lane a message is queued in, lower values are written first
+type SendPriority int
+
+const (
+	//ControlPriority carries login, ping responses and error responses
+	ControlPriority = 0
+	//OPLPriority carries OPL commands and everything without an explicit priority
+	OPLPriority = 1
+	//BulkPriority carries large transfers such as Firmware and RoomsMap
+	BulkPriority = 2
+)
+
+//SendPriorityCount is the number of outbound lanes
+const SendPriorityCount = 3
+
+func (v SendPriority) String() string {
+	dictMap := map[SendPriority]string{
+		0: "ControlPriority",
+		1: "OPLPriority",
+		2: "BulkPriority",
+	}
+
+	return dictMap[v]
+}
@@ -1,3 +1,8 @@
 module github.com/niroopreddym/custom-tcpprotocol-go
 
 go 1.16
+
+require (
+	github.com/fxamacker/cbor/v2 v2.5.0
+	github.com/vmihailenco/msgpack/v5 v5.3.5
+)
@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	//FrameFlagPlain marks a frame body sent as is once compression is negotiated
+	FrameFlagPlain byte = 0
+	//FrameFlagCompressed marks a frame body compressed with the negotiated algorithm
+	FrameFlagCompressed byte = 1
+	//DefaultCompressionThreshold is the body size below which frames are not worth compressing
+	DefaultCompressionThreshold = 1 << 10
+)
+
+//Compressor compresses the frame body after the one byte frame flag
+type Compressor interface {
+	//Name is the algorithm name negotiated at login
+	Name() string
+	//Compress compresses the frame body
+	Compress(data []byte) ([]byte, error)
+	//Decompress inflates the frame body, failing with ErrFrameTooLarge past maxLength bytes
+	Decompress(data []byte, maxLength int) ([]byte, error)
+}
+
+var (
+	//Deflate is raw deflate from compress/flate
+	Deflate Compressor = DeflateCompressor{}
+	//Gzip is gzip from compress/gzip
+	Gzip Compressor = GzipCompressor{}
+)
+
+//SupportedCompressions lists the algorithms offered at login in order of preference
+func SupportedCompressions() []string {
+	return []string{Deflate.Name(), Gzip.Name()}
+}
+
+//CompressorByName returns the compressor for the negotiated algorithm
+func CompressorByName(name string) (Compressor, error) {
+	for _, compressor := range []Compressor{Deflate, Gzip} {
+		if compressor.Name() == name {
+			return compressor, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported compression: %s", name)
+}
+
+//DeflateCompressor compresses frames with raw deflate
+type DeflateCompressor struct{}
+
+//Name is the algorithm name negotiated at login
+func (DeflateCompressor) Name() string {
+	return "deflate"
+}
+
+//Compress compresses the frame body
+func (DeflateCompressor) Compress(data []byte) ([]byte, error) {
+	var buff bytes.Buffer
+	writer, err := flate.NewWriter(&buff, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	return finishCompression(&buff, writer, data)
+}
+
+//Decompress inflates the frame body, failing with ErrFrameTooLarge past maxLength bytes
+func (DeflateCompressor) Decompress(data []byte, maxLength int) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+
+	return readDecompressed(reader, maxLength)
+}
+
+//GzipCompressor compresses frames with gzip
+type GzipCompressor struct{}
+
+//Name is the algorithm name negotiated at login
+func (GzipCompressor) Name() string {
+	return "gzip"
+}
+
+//Compress compresses the frame body
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buff bytes.Buffer
+	return finishCompression(&buff, gzip.NewWriter(&buff), data)
+}
+
+//Decompress inflates the frame body, failing with ErrFrameTooLarge past maxLength bytes
+func (GzipCompressor) Decompress(data []byte, maxLength int) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return readDecompressed(reader, maxLength)
+}
+
+func finishCompression(buff *bytes.Buffer, writer io.WriteCloser, data []byte) ([]byte, error) {
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+func readDecompressed(reader io.Reader, maxLength int) ([]byte, error) {
+	//read one byte past the limit so an oversized body is detected without inflating all of it
+	data, err := ioutil.ReadAll(io.LimitReader(reader, int64(maxLength)+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxLength {
+		return nil, fmt.Errorf("%w: decompressed frame exceeds %d", ErrFrameTooLarge, maxLength)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,56 @@
+package helper
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+//expiredDeadline is any deadline in the past, it aborts the blocked call immediately
+var expiredDeadline = time.Unix(1, 0)
+
+//BindContext applies the context deadline through setDeadline and expires it when the context is cancelled
+//the returned stop func clears the deadline again and must be called once the guarded call returns
+func BindContext(ctx context.Context, setDeadline func(time.Time) error) (stop func()) {
+	if deadline, ok := ctx.Deadline(); ok {
+		setDeadline(deadline)
+	}
+
+	stopped := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			setDeadline(expiredDeadline)
+		case <-stopped:
+		}
+	}()
+
+	return func() {
+		close(stopped)
+		wg.Wait()
+		setDeadline(time.Time{})
+	}
+}
+
+//ContextError prefers the context error over the timeout error it caused on the connection
+func ContextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	//the connection deadline is the context deadline, so the connection can time out just before the context timer fires
+	if deadline, ok := ctx.Deadline(); ok && errors.Is(err, os.ErrDeadlineExceeded) && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+
+	return err
+}
@@ -0,0 +1,140 @@
+package helper
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+//HeaderReader is the reader a Framer pulls the length header from
+type HeaderReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+//Framer encodes and decodes the length prefix in front of every frame
+type Framer interface {
+	//EncodeHeader returns the length prefix for a payload of the given length
+	EncodeHeader(length int) ([]byte, error)
+	//ReadHeader reads the length prefix and returns the announced payload length
+	ReadHeader(reader HeaderReader) (int, error)
+	//MaxLength is the largest payload length the header can carry
+	MaxLength() int
+}
+
+var (
+	//LittleEndianUint32 is the 4 byte prefix written by .NET's BitConverter
+	LittleEndianUint32 Framer = Uint32Framer{ByteOrder: binary.LittleEndian}
+	//BigEndianUint32 is the 4 byte network order prefix used behind the gateway proxies
+	BigEndianUint32 Framer = Uint32Framer{ByteOrder: binary.BigEndian}
+	//LittleEndianUint16 is the 2 byte prefix for small frame deployments
+	LittleEndianUint16 Framer = Uint16Framer{ByteOrder: binary.LittleEndian}
+	//Uvarint is the varint prefix
+	Uvarint Framer = UvarintFramer{}
+	//DefaultFramer is the framing the MTS server speaks
+	DefaultFramer = LittleEndianUint32
+)
+
+//Uint32Framer is a 4 byte prefix, decoded as a signed int32 like the server does
+type Uint32Framer struct {
+	ByteOrder binary.ByteOrder
+}
+
+//EncodeHeader returns the length prefix for a payload of the given length
+func (framer Uint32Framer) EncodeHeader(length int) ([]byte, error) {
+	if err := validateOutboundLength(framer, length); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, Offset)
+	framer.ByteOrder.PutUint32(header, uint32(length))
+	return header, nil
+}
+
+//ReadHeader reads the length prefix and returns the announced payload length
+func (framer Uint32Framer) ReadHeader(reader HeaderReader) (int, error) {
+	header := make([]byte, Offset)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, err
+	}
+
+	return int(int32(framer.ByteOrder.Uint32(header))), nil
+}
+
+//MaxLength is the largest payload length the header can carry
+func (framer Uint32Framer) MaxLength() int {
+	return math.MaxInt32
+}
+
+//Uint16Framer is a 2 byte prefix
+type Uint16Framer struct {
+	ByteOrder binary.ByteOrder
+}
+
+//EncodeHeader returns the length prefix for a payload of the given length
+func (framer Uint16Framer) EncodeHeader(length int) ([]byte, error) {
+	if err := validateOutboundLength(framer, length); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 2)
+	framer.ByteOrder.PutUint16(header, uint16(length))
+	return header, nil
+}
+
+//ReadHeader reads the length prefix and returns the announced payload length
+func (framer Uint16Framer) ReadHeader(reader HeaderReader) (int, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, err
+	}
+
+	return int(framer.ByteOrder.Uint16(header)), nil
+}
+
+//MaxLength is the largest payload length the header can carry
+func (framer Uint16Framer) MaxLength() int {
+	return math.MaxUint16
+}
+
+//UvarintFramer is an unsigned varint prefix as written by binary.PutUvarint
+type UvarintFramer struct{}
+
+//EncodeHeader returns the length prefix for a payload of the given length
+func (framer UvarintFramer) EncodeHeader(length int) ([]byte, error) {
+	if err := validateOutboundLength(framer, length); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(header, uint64(length))
+	return header[:n], nil
+}
+
+//ReadHeader reads the length prefix and returns the announced payload length
+func (framer UvarintFramer) ReadHeader(reader HeaderReader) (int, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return 0, err
+	}
+
+	if length > uint64(framer.MaxLength()) {
+		return 0, fmt.Errorf("%w: %d exceeds %d", ErrFrameTooLarge, length, framer.MaxLength())
+	}
+
+	return int(length), nil
+}
+
+//MaxLength is the largest payload length the header can carry
+func (framer UvarintFramer) MaxLength() int {
+	return math.MaxInt32
+}
+
+func validateOutboundLength(framer Framer, length int) error {
+	if length < 0 || length > framer.MaxLength() {
+		return fmt.Errorf("%w: %d can not be framed, limit is %d", ErrInvalidFrameLength, length, framer.MaxLength())
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package helper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	//ErrFrameTooLarge is returned when an inbound frame announces more bytes than the reader accepts
+	ErrFrameTooLarge = errors.New("frame too large")
+	//ErrInvalidFrameLength is returned when an inbound frame announces a zero or negative length
+	ErrInvalidFrameLength = errors.New("invalid frame length")
+)
+
+//FrameReader reads length prefixed frames from an underlying reader
+type FrameReader struct {
+	//MaxFrameLength is the largest payload accepted from the peer, defaults to MaxMessageLength
+	MaxFrameLength int
+	//Framer decodes the length prefix, defaults to DefaultFramer
+	Framer Framer
+	//Compressor is the negotiated compression, nil reads frames without the frame flag
+	Compressor Compressor
+	reader     *bufio.Reader
+}
+
+//NewFrameReader is the ctor that wraps the reader with a buffered frame reader
+func NewFrameReader(reader io.Reader) *FrameReader {
+	return &FrameReader{
+		MaxFrameLength: MaxMessageLength,
+		Framer:         DefaultFramer,
+		reader:         bufio.NewReader(reader),
+	}
+}
+
+//ReadFrame blocks until a complete frame is available and returns its payload without the length header
+func (frameReader *FrameReader) ReadFrame() ([]byte, error) {
+	frameLength, err := frameReader.Framer.ReadHeader(frameReader.reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := frameReader.validateFrameLength(frameLength); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, frameLength)
+	if _, err := io.ReadFull(frameReader.reader, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if frameReader.Compressor == nil {
+		return frame, nil
+	}
+
+	return frameReader.unwrapFrameFlag(frame)
+}
+
+func (frameReader *FrameReader) unwrapFrameFlag(frame []byte) ([]byte, error) {
+	switch frame[0] {
+	case FrameFlagPlain:
+		return frame[1:], nil
+	case FrameFlagCompressed:
+		return frameReader.Compressor.Decompress(frame[1:], frameReader.MaxFrameLength)
+	default:
+		return nil, fmt.Errorf("unknown frame flag: %d", frame[0])
+	}
+}
+
+func (frameReader *FrameReader) validateFrameLength(frameLength int) error {
+	if frameLength <= 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidFrameLength, frameLength)
+	}
+
+	if frameLength > frameReader.MaxFrameLength {
+		return fmt.Errorf("%w: %d exceeds %d", ErrFrameTooLarge, frameLength, frameReader.MaxFrameLength)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package helper
+
+//FrameWriter prepares outbound frames, compressing the body once a compressor is negotiated
+type FrameWriter struct {
+	//Framer encodes the length prefix, defaults to DefaultFramer
+	Framer Framer
+	//Compressor is the negotiated compression, nil sends frames without the frame flag
+	Compressor Compressor
+	//CompressionThreshold is the body size below which frames go out plain
+	CompressionThreshold int
+}
+
+//NewFrameWriter is the ctor that instantiates the frame writer with the default framing
+func NewFrameWriter() *FrameWriter {
+	return &FrameWriter{
+		Framer:               DefaultFramer,
+		CompressionThreshold: DefaultCompressionThreshold,
+	}
+}
+
+//PrepareFrame returns the framed message ready to be written to the connection
+func (frameWriter *FrameWriter) PrepareFrame(msg []byte) ([]byte, error) {
+	if frameWriter.Compressor == nil {
+		return PrepareFrame(frameWriter.Framer, msg)
+	}
+
+	flag, body := FrameFlagPlain, msg
+	if len(msg) >= frameWriter.CompressionThreshold {
+		compressed, err := frameWriter.Compressor.Compress(msg)
+		if err != nil {
+			return nil, err
+		}
+
+		//only keep the compressed body when it actually saves bytes on the wire
+		if len(compressed) < len(msg) {
+			flag, body = FrameFlagCompressed, compressed
+		}
+	}
+
+	flagged := make([]byte, len(body)+1)
+	flagged[0] = flag
+	copy(flagged[1:], body)
+
+	return PrepareFrame(frameWriter.Framer, flagged)
+}
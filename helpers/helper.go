@@ -1,6 +1,7 @@
 package helper
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/binary"
 	"fmt"
@@ -31,6 +32,16 @@ const (
 
 //PrepareData prepares the data to be sent
 func PrepareData(msg []byte) []byte {
+	data, err := PrepareFrame(DefaultFramer, msg)
+	if err != nil {
+		log.Panic("msglength exception")
+	}
+
+	return data
+}
+
+//PrepareFrame prepends the framer's length header to the message
+func PrepareFrame(framer Framer, msg []byte) ([]byte, error) {
 	// Expected length should be uint (TA8319)
 	msgLength := len(msg)
 	log.Println("Send message length ", msgLength)
@@ -38,17 +49,20 @@ func PrepareData(msg []byte) []byte {
 	if msgLength > MaxMessageLength {
 		var errorMsg = fmt.Sprintf("Messages longer than %d are not supported.", MaxMessageLength)
 		log.Println(errorMsg)
-		log.Panic("msglength exception")
+		return nil, fmt.Errorf("%w: %s", ErrFrameTooLarge, errorMsg)
 	}
 
-	//get bytes fro msgLength for now hard code to 4 i.e., BitConverter.GetBytes(msgLength)
-	byteArrayLen := ConvertIntToByte(int32(msgLength))
-	data := make([]byte, len(byteArrayLen)+msgLength)
+	header, err := framer.EncodeHeader(msgLength)
+	if err != nil {
+		log.Println(err)
+		return nil, err
+	}
 
-	copy(data, byteArrayLen)
-	copy(data[len(byteArrayLen):], msg)
+	data := make([]byte, len(header)+msgLength)
+	copy(data, header)
+	copy(data[len(header):], msg)
 
-	return data
+	return data, nil
 }
 
 //ConvertByteToInt converts the byte data to 4 bit int
@@ -70,24 +84,15 @@ func StrToPointer(str string) *string {
 }
 
 //CreateRequest creates a MTSMessage payload structure used to send to the server
-func CreateRequest(requestType enum.MTSRequest, attrRoute *string, srcID int, dstID int, isError bool, jwt *string, data []byte) model.MTSMessage {
+func CreateRequest(rpcIDs *RPCIDGenerator, requestType enum.MTSRequest, attrRoute *string, srcID int, dstID int, isError bool, jwt *string, data []byte) model.MTSMessage {
 	var rpcID int
-	var lastRPCID int
 	//if OPL request, set RpcId to 0 and don't increment LastRpcId
-	if requestType == enum.OPL {
-		rpcID = 0
-	} else {
-		if lastRPCID == MaxInt {
-			lastRPCID = 1
-		} else {
-			lastRPCID = lastRPCID + 1
-		}
-
-		rpcID = lastRPCID
+	if requestType != enum.OPL {
+		rpcID = rpcIDs.Next()
 	}
 
 	mtsMessage := model.MTSMessage{
-		Version:        1,
+		Version:        ProtocolVersion1,
 		Route:          requestType,
 		SrcID:          srcID,
 		DstID:          dstID,
@@ -102,8 +107,13 @@ func CreateRequest(requestType enum.MTSRequest, attrRoute *string, srcID int, ds
 	return mtsMessage
 }
 
-//GetConnection instantiates and gets the connection
-func GetConnection(connectionString string) (net.Conn, error) {
+//GetConnection instantiates and gets the connection, tunnelling through the proxy when one is given
+func GetConnection(connectionString string, tlsConfig *tls.Config, proxyDialer *ProxyDialer) (net.Conn, error) {
+	return GetConnectionContext(context.Background(), connectionString, tlsConfig, proxyDialer)
+}
+
+//GetConnectionContext bounds the dial, the proxy tunnel and the TLS handshake by the context
+func GetConnectionContext(ctx context.Context, connectionString string, tlsConfig *tls.Config, proxyDialer *ProxyDialer) (net.Conn, error) {
 	defer func() {
 		if r := recover(); r != nil {
 			err := r.(error)
@@ -111,12 +121,28 @@ func GetConnection(connectionString string) (net.Conn, error) {
 		}
 	}()
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
+	var rawConn net.Conn
+	var err error
+	if proxyDialer != nil {
+		rawConn, err = proxyDialer.DialTunnel(ctx, "tcp", connectionString)
+	} else {
+		rawConn, err = (&net.Dialer{}).DialContext(ctx, "tcp", connectionString)
+	}
+
+	if err != nil {
+		err = ContextError(ctx, err)
+		fmt.Println("error occured while establishing the connection: ", err)
+		return nil, err
 	}
 
-	conn, err := tls.Dial("tcp", connectionString, tlsConfig)
+	conn := tls.Client(rawConn, tlsConfig)
+	stop := BindContext(ctx, rawConn.SetDeadline)
+	err = conn.Handshake()
+	stop()
+
 	if err != nil {
+		rawConn.Close()
+		err = ContextError(ctx, classifyTLSError(tlsConfig.ServerName, err))
 		fmt.Println("error occured while establishing the connection: ", err)
 		return nil, err
 	}
@@ -0,0 +1,148 @@
+package helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+var (
+	//ErrMalformedJWT is returned when the token is not three base64url segments with JSON header and claims
+	ErrMalformedJWT = errors.New("malformed jwt")
+	//ErrJWTSignature is returned when the token does not verify against the configured key
+	ErrJWTSignature = errors.New("jwt signature verification failed")
+)
+
+//JWTClaims are the registered claims the client needs to schedule the token refresh
+type JWTClaims struct {
+	Raw       string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+type jwtTimes struct {
+	Exp json.Number `json:"exp"`
+	Iat json.Number `json:"iat"`
+}
+
+//ParseJWT reads the exp and iat claims, the signature is only checked when a key is given
+//key is a []byte secret for HS256, an *rsa.PublicKey for RS256 or an *ecdsa.PublicKey for ES256
+func ParseJWT(raw string, key interface{}) (*JWTClaims, error) {
+	segments := strings.Split(raw, ".")
+	if len(segments) != 3 {
+		return nil, fmt.Errorf("%w: expected 3 segments, got %d", ErrMalformedJWT, len(segments))
+	}
+
+	header := jwtHeader{}
+	if err := decodeJWTSegment(segments[0], &header); err != nil {
+		return nil, err
+	}
+
+	times := jwtTimes{}
+	if err := decodeJWTSegment(segments[1], &times); err != nil {
+		return nil, err
+	}
+
+	if key != nil {
+		if err := verifyJWT(header.Alg, segments, key); err != nil {
+			return nil, err
+		}
+	}
+
+	claims := &JWTClaims{Raw: raw}
+	var err error
+	if claims.ExpiresAt, err = jwtTime(times.Exp); err != nil {
+		return nil, err
+	}
+
+	if claims.IssuedAt, err = jwtTime(times.Iat); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+//Expired reports whether the token is past its exp claim, tokens without exp never expire
+func (claims *JWTClaims) Expired(now time.Time) bool {
+	return !claims.ExpiresAt.IsZero() && !now.Before(claims.ExpiresAt)
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedJWT, err)
+	}
+
+	if err = json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedJWT, err)
+	}
+
+	return nil
+}
+
+func jwtTime(value json.Number) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	seconds, err := value.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrMalformedJWT, err)
+	}
+
+	return time.Unix(0, int64(seconds*float64(time.Second))), nil
+}
+
+func verifyJWT(alg string, segments []string, key interface{}) error {
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[2], "="))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedJWT, err)
+	}
+
+	digest := sha256.Sum256([]byte(segments[0] + "." + segments[1]))
+	switch publicKey := key.(type) {
+	case []byte:
+		if alg != "HS256" {
+			break
+		}
+		mac := hmac.New(sha256.New, publicKey)
+		mac.Write([]byte(segments[0] + "." + segments[1]))
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return nil
+		}
+		return ErrJWTSignature
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			break
+		}
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+		return ErrJWTSignature
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			break
+		}
+		if len(signature) == 64 && ecdsa.Verify(publicKey, digest[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])) {
+			return nil
+		}
+		return ErrJWTSignature
+	default:
+		return fmt.Errorf("%w: unsupported key type %T", ErrJWTSignature, key)
+	}
+
+	return fmt.Errorf("%w: alg %q does not match the %T key", ErrJWTSignature, alg, key)
+}
@@ -0,0 +1,245 @@
+package helper
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//ErrProxyHandshake is returned when the proxy refuses or breaks the tunnel setup
+var ErrProxyHandshake = errors.New("proxy handshake failed")
+
+const (
+	socks5Version         byte = 5
+	socks5NoAuth          byte = 0
+	socks5UserPassword    byte = 2
+	socks5NoAcceptable    byte = 0xff
+	socks5UserPassVersion byte = 1
+	socks5Connect         byte = 1
+	socks5IPv4            byte = 1
+	socks5DomainName      byte = 3
+	socks5IPv6            byte = 4
+)
+
+//DialFunc opens the raw connection to the proxy or to the MTS server
+type DialFunc func(ctx context.Context, network string, address string) (net.Conn, error)
+
+//ProxyDialer tunnels the MTS connection through an HTTP CONNECT or SOCKS5 proxy before the TLS handshake
+type ProxyDialer struct {
+	Type     enum.ProxyType
+	Address  string
+	User     string
+	Password string
+	//Dial opens the connection to the proxy, defaults to a net.Dialer
+	Dial DialFunc
+}
+
+//NewProxyDialer builds the dialer from the MTSClient proxy fields, returns nil when no proxy is configured
+func NewProxyDialer(client model.MTSClient) *ProxyDialer {
+	if client.ProxyType == enum.NoProxy || client.ProxyHostname == "" {
+		return nil
+	}
+
+	return &ProxyDialer{
+		Type:     client.ProxyType,
+		Address:  net.JoinHostPort(client.ProxyHostname, strconv.Itoa(client.ProxyPort)),
+		User:     client.ProxyUser,
+		Password: client.ProxyPassword,
+		Dial:     (&net.Dialer{}).DialContext,
+	}
+}
+
+//DialTunnel connects to the proxy and asks it to open a tunnel to the address
+func (proxyDialer *ProxyDialer) DialTunnel(ctx context.Context, network string, address string) (net.Conn, error) {
+	dial := proxyDialer.Dial
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+
+	conn, err := dial(ctx, network, proxyDialer.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := BindContext(ctx, conn.SetDeadline)
+	defer stop()
+
+	switch proxyDialer.Type {
+	case enum.HTTPConnect:
+		err = proxyDialer.httpConnect(conn, address)
+	case enum.SOCKS5:
+		err = proxyDialer.socks5Connect(conn, address)
+	default:
+		err = fmt.Errorf("%w: unsupported proxy type %d", ErrProxyHandshake, proxyDialer.Type)
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, ContextError(ctx, err)
+	}
+
+	return conn, nil
+}
+
+func (proxyDialer *ProxyDialer) httpConnect(conn net.Conn, address string) error {
+	request, err := http.NewRequest(http.MethodConnect, "http://"+address, nil)
+	if err != nil {
+		return err
+	}
+
+	request.Host = address
+	if proxyDialer.User != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyDialer.User + ":" + proxyDialer.Password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if err = request.Write(conn); err != nil {
+		return err
+	}
+
+	//the MTS side stays silent until the TLS client hello, so nothing past the headers gets buffered
+	response, err := http.ReadResponse(bufio.NewReader(conn), request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: CONNECT %s returned %s", ErrProxyHandshake, address, response.Status)
+	}
+
+	return nil
+}
+
+func (proxyDialer *ProxyDialer) socks5Connect(conn net.Conn, address string) error {
+	method := socks5NoAuth
+	if proxyDialer.User != "" {
+		method = socks5UserPassword
+	}
+
+	if _, err := conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+
+	if reply[0] != socks5Version || reply[1] == socks5NoAcceptable || reply[1] != method {
+		return fmt.Errorf("%w: socks5 proxy refused authentication method %d", ErrProxyHandshake, method)
+	}
+
+	if method == socks5UserPassword {
+		if err := proxyDialer.socks5Authenticate(conn); err != nil {
+			return err
+		}
+	}
+
+	request, err := socks5ConnectRequest(address)
+	if err != nil {
+		return err
+	}
+
+	if _, err = conn.Write(request); err != nil {
+		return err
+	}
+
+	return readSocks5ConnectReply(conn, address)
+}
+
+func (proxyDialer *ProxyDialer) socks5Authenticate(conn net.Conn) error {
+	if len(proxyDialer.User) > 255 || len(proxyDialer.Password) > 255 {
+		return fmt.Errorf("%w: socks5 credentials longer than 255 bytes", ErrProxyHandshake)
+	}
+
+	request := []byte{socks5UserPassVersion, byte(len(proxyDialer.User))}
+	request = append(request, proxyDialer.User...)
+	request = append(request, byte(len(proxyDialer.Password)))
+	request = append(request, proxyDialer.Password...)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+
+	if reply[1] != 0 {
+		return fmt.Errorf("%w: socks5 proxy rejected the credentials", ErrProxyHandshake)
+	}
+
+	return nil
+}
+
+func socks5ConnectRequest(address string) ([]byte, error) {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	request := []byte{socks5Version, socks5Connect, 0}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			request = append(append(request, socks5IPv4), ip4...)
+		} else {
+			request = append(append(request, socks5IPv6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("%w: hostname %s too long", ErrProxyHandshake, host)
+		}
+		request = append(append(request, socks5DomainName, byte(len(host))), host...)
+	}
+
+	portBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(portBytes, uint16(port))
+	return append(request, portBytes...), nil
+}
+
+func readSocks5ConnectReply(conn net.Conn, address string) error {
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+
+	if reply[1] != 0 {
+		return fmt.Errorf("%w: socks5 proxy could not connect to %s, reply code %d", ErrProxyHandshake, address, reply[1])
+	}
+
+	//skip the bound address and port the proxy reports back
+	var boundLength int
+	switch reply[3] {
+	case socks5IPv4:
+		boundLength = net.IPv4len
+	case socks5IPv6:
+		boundLength = net.IPv6len
+	case socks5DomainName:
+		lengthByte := make([]byte, 1)
+		if _, err := io.ReadFull(conn, lengthByte); err != nil {
+			return err
+		}
+		boundLength = int(lengthByte[0])
+	default:
+		return fmt.Errorf("%w: socks5 proxy replied with address type %d", ErrProxyHandshake, reply[3])
+	}
+
+	_, err := io.ReadFull(conn, make([]byte, boundLength+2))
+	return err
+}
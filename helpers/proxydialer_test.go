@@ -0,0 +1,275 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+)
+
+//pipeDialer hands the client end of a net.Pipe to the dialer and runs the proxy stand-in on the other end
+func pipeDialer(t *testing.T, proxy func(conn net.Conn) error) (DialFunc, chan error) {
+	t.Helper()
+	proxyErr := make(chan error, 1)
+	dial := func(ctx context.Context, network string, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			proxyErr <- proxy(server)
+		}()
+		return client, nil
+	}
+
+	return dial, proxyErr
+}
+
+func dialWithTimeout(t *testing.T, proxyDialer *ProxyDialer) (net.Conn, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	return proxyDialer.DialTunnel(ctx, "tcp", "mts.example.com:8443")
+}
+
+func TestProxyDialerHTTPConnect(t *testing.T) {
+	tests := []struct {
+		name          string
+		user          string
+		password      string
+		authorization string
+	}{
+		{name: "without auth"},
+		{name: "with basic auth", user: "proxyuser", password: "secret", authorization: "Basic " + base64.StdEncoding.EncodeToString([]byte("proxyuser:secret"))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dial, proxyErr := pipeDialer(t, func(conn net.Conn) error {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				request, err := http.ReadRequest(reader)
+				if err != nil {
+					return err
+				}
+
+				if request.Method != http.MethodConnect || request.Host != "mts.example.com:8443" {
+					return errors.New("unexpected request " + request.Method + " " + request.Host)
+				}
+				if got := request.Header.Get("Proxy-Authorization"); got != test.authorization {
+					return errors.New("unexpected Proxy-Authorization " + got)
+				}
+
+				if _, err = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+					return err
+				}
+
+				//echo one tunnelled message back to prove the tunnel carries raw bytes
+				tunnelled := make([]byte, 5)
+				if _, err = io.ReadFull(reader, tunnelled); err != nil {
+					return err
+				}
+				_, err = conn.Write(tunnelled)
+				return err
+			})
+
+			conn, err := dialWithTimeout(t, &ProxyDialer{Type: enum.HTTPConnect, Address: "proxy:3128", User: test.user, Password: test.password, Dial: dial})
+			if err != nil {
+				t.Fatalf("DialTunnel: %v", err)
+			}
+			defer conn.Close()
+
+			assertTunnelEchoes(t, conn)
+			if err = <-proxyErr; err != nil {
+				t.Fatalf("proxy: %v", err)
+			}
+		})
+	}
+}
+
+func TestProxyDialerHTTPConnectRefused(t *testing.T) {
+	dial, _ := pipeDialer(t, func(conn net.Conn) error {
+		defer conn.Close()
+		if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+			return err
+		}
+
+		_, err := io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n")
+		return err
+	})
+
+	_, err := dialWithTimeout(t, &ProxyDialer{Type: enum.HTTPConnect, Address: "proxy:3128", Dial: dial})
+	if !errors.Is(err, ErrProxyHandshake) {
+		t.Fatalf("expected ErrProxyHandshake, got %v", err)
+	}
+}
+
+func TestProxyDialerSOCKS5(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     string
+		password string
+	}{
+		{name: "without auth"},
+		{name: "with username and password", user: "proxyuser", password: "secret"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dial, proxyErr := pipeDialer(t, func(conn net.Conn) error {
+				defer conn.Close()
+				method := socks5NoAuth
+				if test.user != "" {
+					method = socks5UserPassword
+				}
+
+				if err := expectBytes(conn, []byte{socks5Version, 1, method}); err != nil {
+					return err
+				}
+				if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+					return err
+				}
+
+				if method == socks5UserPassword {
+					auth := append([]byte{socks5UserPassVersion, byte(len(test.user))}, test.user...)
+					auth = append(append(auth, byte(len(test.password))), test.password...)
+					if err := expectBytes(conn, auth); err != nil {
+						return err
+					}
+					if _, err := conn.Write([]byte{socks5UserPassVersion, 0}); err != nil {
+						return err
+					}
+				}
+
+				connect := append([]byte{socks5Version, socks5Connect, 0, socks5DomainName, byte(len("mts.example.com"))}, "mts.example.com"...)
+				connect = append(connect, 0x20, 0xfb)
+				if err := expectBytes(conn, connect); err != nil {
+					return err
+				}
+				if _, err := conn.Write([]byte{socks5Version, 0, 0, socks5IPv4, 10, 0, 0, 1, 0x1f, 0x90}); err != nil {
+					return err
+				}
+
+				tunnelled := make([]byte, 5)
+				if _, err := io.ReadFull(conn, tunnelled); err != nil {
+					return err
+				}
+				_, err := conn.Write(tunnelled)
+				return err
+			})
+
+			conn, err := dialWithTimeout(t, &ProxyDialer{Type: enum.SOCKS5, Address: "proxy:1080", User: test.user, Password: test.password, Dial: dial})
+			if err != nil {
+				t.Fatalf("DialTunnel: %v", err)
+			}
+			defer conn.Close()
+
+			assertTunnelEchoes(t, conn)
+			if err = <-proxyErr; err != nil {
+				t.Fatalf("proxy: %v", err)
+			}
+		})
+	}
+}
+
+func TestProxyDialerSOCKS5Refused(t *testing.T) {
+	tests := []struct {
+		name  string
+		user  string
+		proxy func(conn net.Conn) error
+	}{
+		{
+			name: "no acceptable method",
+			proxy: func(conn net.Conn) error {
+				if _, err := io.ReadFull(conn, make([]byte, 3)); err != nil {
+					return err
+				}
+				_, err := conn.Write([]byte{socks5Version, socks5NoAcceptable})
+				return err
+			},
+		},
+		{
+			name: "credentials rejected",
+			user: "proxyuser",
+			proxy: func(conn net.Conn) error {
+				if _, err := io.ReadFull(conn, make([]byte, 3)); err != nil {
+					return err
+				}
+				if _, err := conn.Write([]byte{socks5Version, socks5UserPassword}); err != nil {
+					return err
+				}
+				if _, err := io.ReadFull(conn, make([]byte, 3+len("proxyuser"))); err != nil {
+					return err
+				}
+				_, err := conn.Write([]byte{socks5UserPassVersion, 1})
+				return err
+			},
+		},
+		{
+			name: "connect refused",
+			proxy: func(conn net.Conn) error {
+				if _, err := io.ReadFull(conn, make([]byte, 3)); err != nil {
+					return err
+				}
+				if _, err := conn.Write([]byte{socks5Version, socks5NoAuth}); err != nil {
+					return err
+				}
+				if _, err := io.ReadFull(conn, make([]byte, 7+len("mts.example.com"))); err != nil {
+					return err
+				}
+				//5 is connection refused
+				_, err := conn.Write([]byte{socks5Version, 5, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dial, _ := pipeDialer(t, func(conn net.Conn) error {
+				defer conn.Close()
+				return test.proxy(conn)
+			})
+
+			_, err := dialWithTimeout(t, &ProxyDialer{Type: enum.SOCKS5, Address: "proxy:1080", User: test.user, Dial: dial})
+			if !errors.Is(err, ErrProxyHandshake) {
+				t.Fatalf("expected ErrProxyHandshake, got %v", err)
+			}
+		})
+	}
+}
+
+func expectBytes(conn net.Conn, expected []byte) error {
+	got := make([]byte, len(expected))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(got, expected) {
+		return errors.New("unexpected bytes from the dialer")
+	}
+
+	return nil
+}
+
+func assertTunnelEchoes(t *testing.T, conn net.Conn) {
+	t.Helper()
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatalf("write through tunnel: %v", err)
+	}
+
+	echoed := make([]byte, 5)
+	if _, err := io.ReadFull(conn, echoed); err != nil {
+		t.Fatalf("read through tunnel: %v", err)
+	}
+
+	if string(echoed) != "hello" {
+		t.Fatalf("tunnel echoed %q", echoed)
+	}
+}
@@ -1,17 +1,17 @@
 package helper
 
 import (
-	"encoding/json"
 	"fmt"
 
+	"github.com/niroopreddym/custom-tcpprotocol-go/codec"
 	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
 	"github.com/niroopreddym/custom-tcpprotocol-go/model"
 )
 
-//CreateResponse creates a MTSMessage as Response
+//CreateResponse creates a MTSMessage as Response in the version the request was sent in
 func CreateResponse(requestMessage *model.MTSMessage, responseType enum.MTSRequest, attrRoute *string, isError bool, jwt *string, data []byte) model.MTSMessage {
 	mtsMessage := model.MTSMessage{
-		Version:        1,
+		Version:        requestMessage.Version,
 		Route:          responseType,
 		SrcID:          requestMessage.DstID,
 		DstID:          requestMessage.SrcID,
@@ -27,13 +27,13 @@ func CreateResponse(requestMessage *model.MTSMessage, responseType enum.MTSReque
 }
 
 //CreateErrorResponse error response
-func CreateErrorResponse(errorID enum.MtsErrorID, errorMsg string, requestMessage *model.MTSMessage, responseType enum.MTSRequest, attrRoute *string, jwt *string) model.MTSMessage {
+func CreateErrorResponse(messageCodec codec.Codec, errorID enum.MtsErrorID, errorMsg string, requestMessage *model.MTSMessage, responseType enum.MTSRequest, attrRoute *string, jwt *string) model.MTSMessage {
 	var errorResponseData = model.MtsErrorResponse{
 		MtsError:        errorID,
 		MtsErrorMessage: errorMsg,
 	}
 
-	errorResponseByteArray, err := json.Marshal(errorResponseData)
+	errorResponseByteArray, err := messageCodec.Marshal(errorResponseData)
 	if err != nil {
 		fmt.Println("Error getting the client cert", err)
 	}
@@ -0,0 +1,27 @@
+package helper
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+//RPCIDGenerator hands out the rpcId of outgoing requests, every client owns one
+//the counter is 32 bits wide so it needs no 64-bit alignment when embedded in a struct on 386 or ARM
+type RPCIDGenerator struct {
+	lastRPCID int32
+}
+
+//Next returns the next rpcId, wrapping back to 1 after the server's int32 range
+func (generator *RPCIDGenerator) Next() int {
+	for {
+		last := atomic.LoadInt32(&generator.lastRPCID)
+		next := int32(1)
+		if last < math.MaxInt32 {
+			next = last + 1
+		}
+
+		if atomic.CompareAndSwapInt32(&generator.lastRPCID, last, next) {
+			return int(next)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+var (
+	//ErrCertificateVerification is matched by every TLSVerificationError
+	ErrCertificateVerification = errors.New("tls certificate verification failed")
+	//ErrUnknownAuthority is returned when the server chain does not lead to a trusted root
+	ErrUnknownAuthority = errors.New("certificate signed by unknown authority")
+	//ErrServerNameMismatch is returned when the server certificate is not valid for the expected server name
+	ErrServerNameMismatch = errors.New("certificate is not valid for the server name")
+	//ErrCertificateInvalid is returned when the server certificate is expired or not usable for TLS
+	ErrCertificateInvalid = errors.New("certificate is invalid")
+	//ErrPinMismatch is returned when no certificate in the verified chain matches a pinned SPKI hash
+	ErrPinMismatch = errors.New("no certificate matches the pinned public keys")
+)
+
+//TLSVerificationError is returned by GetConnection when the server certificate is rejected
+type TLSVerificationError struct {
+	ServerName string
+	Reason     error
+	Err        error
+}
+
+func (verificationError *TLSVerificationError) Error() string {
+	if verificationError.Err == nil {
+		return fmt.Sprintf("tls verification of %s failed: %v", verificationError.ServerName, verificationError.Reason)
+	}
+
+	return fmt.Sprintf("tls verification of %s failed: %v: %v", verificationError.ServerName, verificationError.Reason, verificationError.Err)
+}
+
+//Unwrap returns the underlying x509 error
+func (verificationError *TLSVerificationError) Unwrap() error {
+	return verificationError.Err
+}
+
+//Is matches ErrCertificateVerification and the specific reason
+func (verificationError *TLSVerificationError) Is(target error) bool {
+	return target == ErrCertificateVerification || target == verificationError.Reason
+}
+
+//TLSPolicy describes how the server is verified and how the client authenticates itself
+type TLSPolicy struct {
+	//RootCAs are the trusted roots, nil uses the system pool
+	RootCAs *x509.CertPool
+	//ServerName is the name expected in the server certificate, defaults to the dialed hostname
+	ServerName string
+	//SPKIPins are SHA-256 hashes of trusted SubjectPublicKeyInfo, one must appear in the verified chain
+	SPKIPins [][]byte
+	//ClientCertificate is the PEM encoded client certificate for mTLS
+	ClientCertificate []byte
+	//ClientKey is the PEM encoded private key, nil expects the key inside ClientCertificate
+	ClientKey []byte
+	//InsecureSkipVerify disables verification, only meant for local test servers
+	InsecureSkipVerify bool
+}
+
+//LoadCertPool reads the PEM encoded CA certificates into a pool
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	return pool, nil
+}
+
+//SPKIPin returns the SHA-256 pin of the certificate's SubjectPublicKeyInfo
+func SPKIPin(certificate *x509.Certificate) []byte {
+	pin := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return pin[:]
+}
+
+//TLSConfig builds the tls.Config for dialing the hostname
+func (policy *TLSPolicy) TLSConfig(hostname string) (*tls.Config, error) {
+	serverName := policy.ServerName
+	if serverName == "" {
+		serverName = hostname
+	}
+
+	tlsConfig := &tls.Config{
+		RootCAs:            policy.RootCAs,
+		ServerName:         serverName,
+		InsecureSkipVerify: policy.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if len(policy.ClientCertificate) > 0 {
+		clientKey := policy.ClientKey
+		if clientKey == nil {
+			clientKey = policy.ClientCertificate
+		}
+
+		certificate, err := tls.X509KeyPair(policy.ClientCertificate, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	if len(policy.SPKIPins) > 0 && !policy.InsecureSkipVerify {
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return policy.verifyPins(serverName, state)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func (policy *TLSPolicy) verifyPins(serverName string, state tls.ConnectionState) error {
+	for _, chain := range state.VerifiedChains {
+		for _, certificate := range chain {
+			pin := SPKIPin(certificate)
+			for _, expected := range policy.SPKIPins {
+				if bytes.Equal(pin, expected) {
+					return nil
+				}
+			}
+		}
+	}
+
+	return &TLSVerificationError{ServerName: serverName, Reason: ErrPinMismatch}
+}
+
+//classifyTLSError turns x509 verification failures into a TLSVerificationError
+func classifyTLSError(serverName string, err error) error {
+	var verificationError *TLSVerificationError
+	if errors.As(err, &verificationError) {
+		return verificationError
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	if errors.As(err, &unknownAuthority) {
+		return &TLSVerificationError{ServerName: serverName, Reason: ErrUnknownAuthority, Err: err}
+	}
+
+	var hostnameError x509.HostnameError
+	if errors.As(err, &hostnameError) {
+		return &TLSVerificationError{ServerName: serverName, Reason: ErrServerNameMismatch, Err: err}
+	}
+
+	var certificateInvalid x509.CertificateInvalidError
+	if errors.As(err, &certificateInvalid) {
+		return &TLSVerificationError{ServerName: serverName, Reason: ErrCertificateInvalid, Err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,18 @@
+package helper
+
+//ProtocolVersion1 is the message format every server understands, messages use it until login negotiates another one
+const ProtocolVersion1 byte = 1
+
+//VersionRange is the inclusive range of MTSMessage versions a client speaks
+type VersionRange struct {
+	Min byte
+	Max byte
+}
+
+//DefaultVersionRange only speaks the original message format
+var DefaultVersionRange = VersionRange{Min: ProtocolVersion1, Max: ProtocolVersion1}
+
+//Contains reports whether the version is inside the range
+func (versionRange VersionRange) Contains(version byte) bool {
+	return version >= versionRange.Min && version <= versionRange.Max
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -18,9 +18,6 @@ import (
 //TestElapsedSeconds intial time to trigger the fan out test events
 var TestElapsedSeconds = 1
 
-//get these values securely from the env
-const username = "mtstest"
-const password = "Test123"
 const port = 10002
 
 func main() {
@@ -43,34 +40,39 @@ func main() {
 	}()
 
 	tcpConnect := mtsclient.NewTCPConnect("127.0.0.1", port, 10000)
-	tcpConnect.UserName = helper.StrToPointer(username)
-	tcpConnect.Password = helper.StrToPointer(password)
+	//the password login reads MTS_USERNAME and MTS_PASSWORD, swap in FileCredentials or CommandCredentials to use a secret store
+	tcpConnect.Credentials = mtsclient.EnvCredentials{}
+	//restarts log in with the saved client certificate and only fall back to the password when it is rejected
+	tcpConnect.CertificateStore = mtsclient.FileCertificateStore{Path: "mts-client.cert"}
 
-	defer tcpConnect.Conn.Close()
-	//do all operations on top of TLS
-	tcpConnect.WithTLS(nil)
+	defer tcpConnect.Close()
+	//do all operations on top of TLS, the local test server uses a self signed certificate
+	//real deployments set RootCAs, ServerName and SPKIPins instead of skipping verification
+	tcpConnect.WithTLS(&helper.TLSPolicy{InsecureSkipVerify: true})
 
-	tcpConnect.ConnectAndLogin()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
+	//refresh the session token with the client certificate before it expires
+	go tcpConnect.Tokens.Run(ctx)
+
+	supervisor := mtsclient.NewSupervisor(tcpConnect, mtsclient.DefaultBackoffPolicy())
+	supervisorDone := make(chan error, 1)
+	go func() { supervisorDone <- supervisor.Run(ctx) }()
+
+	testsStarted := false
 	for {
 		select {
-		case isDone := <-tcpConnect.ServerBootDone:
-			if !isDone {
-				fmt.Println("Un-Authenticated")
-				os.Exit(1)
-			}
-
-			tcpConnect.Wg.Add(1)
-			go sendOPLTestMessages(tcpConnect, &tcpConnect.Wg)
-			tcpConnect.Wg.Wait()
-		case msg := <-tcpConnect.ErrorChan:
-			fmt.Println("BOOM!", msg.Error())
-			if strings.Contains(msg.Error(), "use of closed network connection") {
-				time.Sleep(500 * time.Millisecond) // has to be exponential backoff mechanism
-			} else {
-				fmt.Println(msg)
-				os.Exit(1)
+		case state := <-supervisor.States:
+			fmt.Println("connection state: ", state)
+			if state == enum.Connected && !testsStarted {
+				testsStarted = true
+				tcpConnect.Wg.Add(1)
+				go sendOPLTestMessages(tcpConnect, &tcpConnect.Wg)
 			}
+		case err := <-supervisorDone:
+			fmt.Println("BOOM!", err.Error())
+			os.Exit(1)
 		case <-done:
 			return
 		default:
@@ -2,6 +2,8 @@ package model
 
 import (
 	"net"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
 )
 
 //MTSClient provides the struct
@@ -13,6 +15,7 @@ type MTSClient struct {
 	Port                  int
 	UseTLS                bool
 	ClientCertificate     []byte
+	ProxyType             enum.ProxyType
 	ProxyHostname         string
 	ProxyPort             int
 	ProxyUser             string
@@ -0,0 +1,24 @@
+package model
+
+//MtsCommunicationKeyRequest is the CommunicationKeyReq payload asking for the keys that encrypt lock commands
+type MtsCommunicationKeyRequest struct {
+	//RoomIDs limits the request to these rooms, empty asks for every key the app may use
+	RoomIDs []string `json:",omitempty"`
+}
+
+//MtsCommunicationKey is one key of a communication key reply
+type MtsCommunicationKey struct {
+	KeyID string
+	//RoomID is the room the key belongs to, empty for a key shared by every room
+	RoomID string `json:",omitempty"`
+	Key    []byte
+	//ExpiresAt is the unix time in seconds the key stops being valid, 0 when the server did not send one
+	ExpiresAt int64 `json:",omitempty"`
+}
+
+//MtsCommunicationKeys is the RMSCommunicationKeys or PPCommunicationKeys payload
+type MtsCommunicationKeys struct {
+	Keys []MtsCommunicationKey
+	//ValidSeconds is how long the whole set may be cached, 0 when the server did not send one
+	ValidSeconds int `json:",omitempty"`
+}
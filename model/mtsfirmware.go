@@ -0,0 +1,37 @@
+package model
+
+import "github.com/niroopreddym/custom-tcpprotocol-go/enum"
+
+//MtsFirmwareRequest asks for a download chunk or for the resume offset of an upload
+type MtsFirmwareRequest struct {
+	Operation  enum.FirmwareOperation
+	TransferID string
+	//FirmwareID names the image to download
+	FirmwareID string
+	//Offset is the first byte wanted by a download
+	Offset int64
+	//MaxChunkSize caps the chunk the server sends back
+	MaxChunkSize int
+}
+
+//MtsFirmwareChunk is one sequenced slice of a firmware image
+type MtsFirmwareChunk struct {
+	Operation  enum.FirmwareOperation
+	TransferID string
+	Sequence   int
+	Offset     int64
+	Data       []byte
+	//Final marks the last chunk, it carries the SHA-256 of the whole image
+	Final  bool
+	SHA256 []byte
+}
+
+//MtsFirmwareAck acknowledges the bytes of an upload stored so far
+type MtsFirmwareAck struct {
+	TransferID string
+	Sequence   int
+	//NextOffset is the first byte the receiver has not stored yet
+	NextOffset int64
+	//Verified is set on the final ack once the digest matched
+	Verified bool
+}
@@ -9,4 +9,9 @@ type MtsLogin struct {
 	AppID             enum.AppID
 	AppKey            []byte
 	ClientCertificate []byte
+	//Compression lists the frame compressions the client supports, in order of preference
+	Compression []string `json:",omitempty"`
+	//MinVersion and MaxVersion advertise the MTSMessage versions the client speaks
+	MinVersion byte `json:",omitempty"`
+	MaxVersion byte `json:",omitempty"`
 }
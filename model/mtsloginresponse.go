@@ -8,10 +8,14 @@ type MtsLoginResponse struct {
 	ClientCertificate []byte
 	//ServerCertInfo Not used
 	ServerCertInfo string
-	//MtuBluetooth Not used
+	//MtuBluetooth is the largest bluetooth packet, kept in the session for the portable programmer roles
 	MtuBluetooth int
-	//MtuOpl Not used
+	//MtuOpl is the largest OPL payload Data the server accepts
 	MtuOpl int
-	//MtuMts Not used
+	//MtuMts is the largest frame the server accepts
 	MtuMts int
+	//Compression is the frame compression the server picked, empty keeps frames uncompressed
+	Compression string `json:",omitempty"`
+	//Version is the MTSMessage version the server picked, 0 from servers that predate negotiation means version 1
+	Version byte `json:",omitempty"`
 }
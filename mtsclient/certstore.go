@@ -0,0 +1,159 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+//CertificateStore keeps the issued client certificate across restarts so the client can skip the password login
+type CertificateStore interface {
+	//Load returns nil without an error when no certificate was saved yet
+	Load(ctx context.Context) ([]byte, error)
+	Save(ctx context.Context, certificate []byte) error
+	//Clear forgets a certificate the server no longer accepts
+	Clear(ctx context.Context) error
+}
+
+//MemoryCertificateStore keeps the certificate for the lifetime of the process
+type MemoryCertificateStore struct {
+	mutex       sync.RWMutex
+	certificate []byte
+}
+
+//NewMemoryCertificateStore is the ctor for an empty in-memory store
+func NewMemoryCertificateStore() *MemoryCertificateStore {
+	return &MemoryCertificateStore{}
+}
+
+//Load returns a copy of the saved certificate
+func (store *MemoryCertificateStore) Load(ctx context.Context) ([]byte, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return append([]byte(nil), store.certificate...), nil
+}
+
+//Save replaces the saved certificate
+func (store *MemoryCertificateStore) Save(ctx context.Context, certificate []byte) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.certificate = append([]byte(nil), certificate...)
+	return nil
+}
+
+//Clear forgets the saved certificate
+func (store *MemoryCertificateStore) Clear(ctx context.Context) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.certificate = nil
+	return nil
+}
+
+//FileCertificateStore keeps the certificate in a file only the owner can read
+type FileCertificateStore struct {
+	Path string
+}
+
+//Load reads the certificate file, a missing file means no certificate was saved yet
+//the certificate logs in without a password, so a file group or others can access is rejected like a credential file
+func (store FileCertificateStore) Load(ctx context.Context) ([]byte, error) {
+	info, err := os.Stat(store.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkOwnerOnly(store.Path, info); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(store.Path)
+}
+
+//Save writes the certificate next to the target and renames it over, so a crash never leaves half a certificate behind
+func (store FileCertificateStore) Save(ctx context.Context, certificate []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(store.Path), filepath.Base(store.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err = file.Chmod(0600); err == nil {
+		_, err = file.Write(certificate)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), store.Path)
+}
+
+//Clear removes the certificate file
+func (store FileCertificateStore) Clear(ctx context.Context) error {
+	err := os.Remove(store.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+//loginWithStoredCertificate tries the saved certificate, it reports false when the password login has to run instead
+func (connect *TCPConnect) loginWithStoredCertificate(ctx context.Context) (bool, error) {
+	if connect.CertificateStore == nil {
+		return false, nil
+	}
+
+	certificate, err := connect.CertificateStore.Load(ctx)
+	if err != nil {
+		fmt.Println("error loading the stored client certificate: ", err)
+		return false, nil
+	}
+
+	if len(certificate) == 0 {
+		return false, nil
+	}
+
+	connect.Session.SetClientCertificate(certificate)
+	err = connect.reconnectWithCertificate(ctx)
+	if !errors.Is(err, ErrInvalidLogin) {
+		return true, err
+	}
+
+	//the server revoked or expired the certificate, fall back to the password login
+	fmt.Println("stored client certificate rejected: ", err)
+	connect.closeConn()
+	connect.Session.SetClientCertificate(nil)
+	if err = connect.CertificateStore.Clear(ctx); err != nil {
+		fmt.Println("error clearing the stored client certificate: ", err)
+	}
+
+	return false, nil
+}
+
+//saveCertificate persists a newly issued certificate, a failing store only costs the password login on the next start
+func (connect *TCPConnect) saveCertificate(ctx context.Context, certificate []byte) {
+	if connect.CertificateStore == nil || len(certificate) == 0 {
+		return
+	}
+
+	if err := connect.CertificateStore.Save(ctx, certificate); err != nil {
+		fmt.Println("error storing the client certificate: ", err)
+	}
+}
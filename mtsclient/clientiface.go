@@ -1,10 +1,19 @@
 package mtsclient
 
-import "github.com/niroopreddym/custom-tcpprotocol-go/model"
+import (
+	"context"
+
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
 
 //ITCPConnect exposes the required methods for the communiation with the Onity Server
 type ITCPConnect interface {
 	ConnectAndLogin()
-	WithTLS(certificate []byte)
+	ConnectAndLoginContext(ctx context.Context) error
+	WithTLS(policy *helper.TLSPolicy)
 	SendMTSOPLPayload(mtsOPLPayload *model.MtsOplPayload)
+	SendMTSOPLPayloadContext(ctx context.Context, mtsOPLPayload *model.MtsOplPayload) error
+	SendDataToServer(mtsMessage model.MTSMessage) error
+	SendDataToServerContext(ctx context.Context, mtsMessage model.MTSMessage) error
 }
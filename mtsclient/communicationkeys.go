@@ -0,0 +1,168 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//ErrCommunicationKeyNotFound is returned when the key set has no key for the room
+var ErrCommunicationKeyNotFound = errors.New("communication key not found")
+
+//DefaultCommunicationKeyTTL is how long a key set is cached when the server sends no expiry
+const DefaultCommunicationKeyTTL = time.Hour
+
+//CommunicationKeyCache keeps the last communication key set until its first key expires
+type CommunicationKeyCache struct {
+	//TTL caps how long a set is cached, 0 uses DefaultCommunicationKeyTTL
+	TTL     time.Duration
+	mutex   sync.Mutex
+	keys    []model.MtsCommunicationKey
+	expires time.Time
+	//fetch serialises the requests so concurrent cache misses share one round trip
+	fetch sync.Mutex
+}
+
+//NewCommunicationKeyCache is the ctor for an empty cache
+func NewCommunicationKeyCache() *CommunicationKeyCache {
+	return &CommunicationKeyCache{TTL: DefaultCommunicationKeyTTL}
+}
+
+//Keys returns a copy of the cached set, false when it is empty or expired
+func (cache *CommunicationKeyCache) Keys() ([]model.MtsCommunicationKey, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.keys == nil || !time.Now().Before(cache.expires) {
+		return nil, false
+	}
+
+	return append([]model.MtsCommunicationKey(nil), cache.keys...), true
+}
+
+//Store replaces the cached set, it expires with its earliest key or after ValidSeconds or the TTL, whichever comes first
+func (cache *CommunicationKeyCache) Store(keys *model.MtsCommunicationKeys) {
+	ttl := cache.TTL
+	if ttl <= 0 {
+		ttl = DefaultCommunicationKeyTTL
+	}
+
+	now := time.Now()
+	expires := now.Add(ttl)
+	if keys.ValidSeconds > 0 {
+		if validUntil := now.Add(time.Duration(keys.ValidSeconds) * time.Second); validUntil.Before(expires) {
+			expires = validUntil
+		}
+	}
+
+	for _, key := range keys.Keys {
+		if key.ExpiresAt > 0 {
+			if keyExpires := time.Unix(key.ExpiresAt, 0); keyExpires.Before(expires) {
+				expires = keyExpires
+			}
+		}
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.keys = append([]model.MtsCommunicationKey{}, keys.Keys...)
+	cache.expires = expires
+}
+
+//Invalidate drops the cached set, the next lookup asks the server again
+func (cache *CommunicationKeyCache) Invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.keys = nil
+	cache.expires = time.Time{}
+}
+
+//RequestCommunicationKeys asks the server for a fresh key set on CommunicationKeyReq and caches the reply
+func (connect *TCPConnect) RequestCommunicationKeys(ctx context.Context, roomIDs ...string) (*model.MtsCommunicationKeys, error) {
+	reply, err := connect.Call(ctx, enum.CommunicationKeyReq, model.MtsCommunicationKeyRequest{RoomIDs: roomIDs})
+	if err != nil {
+		return nil, err
+	}
+
+	if reply.Route != enum.RMSCommunicationKeys && reply.Route != enum.PPCommunicationKeys {
+		return nil, fmt.Errorf("communication key request answered on %s", reply.Route)
+	}
+
+	keys := model.MtsCommunicationKeys{}
+	if err = connect.codec().Unmarshal(reply.Data, &keys); err != nil {
+		return nil, err
+	}
+
+	//a partial set would hide the keys of the other rooms from the cache
+	if len(roomIDs) == 0 {
+		connect.KeyCache.Store(&keys)
+	}
+
+	return &keys, nil
+}
+
+//CommunicationKeys returns the cached key set, requesting a new one when it expired
+func (connect *TCPConnect) CommunicationKeys(ctx context.Context) ([]model.MtsCommunicationKey, error) {
+	if keys, ok := connect.KeyCache.Keys(); ok {
+		return keys, nil
+	}
+
+	connect.KeyCache.fetch.Lock()
+	defer connect.KeyCache.fetch.Unlock()
+
+	//another caller may have refreshed the set while this one waited
+	if keys, ok := connect.KeyCache.Keys(); ok {
+		return keys, nil
+	}
+
+	keys, err := connect.RequestCommunicationKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return keys.Keys, nil
+}
+
+//CommunicationKey returns the key for the room, falling back to a key shared by every room
+func (connect *TCPConnect) CommunicationKey(ctx context.Context, roomID string) (*model.MtsCommunicationKey, error) {
+	keys, err := connect.CommunicationKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var shared *model.MtsCommunicationKey
+	for i := range keys {
+		switch keys[i].RoomID {
+		case roomID:
+			return &keys[i], nil
+		case "":
+			if shared == nil {
+				shared = &keys[i]
+			}
+		}
+	}
+
+	if shared != nil {
+		return shared, nil
+	}
+
+	return nil, fmt.Errorf("%w: room %s", ErrCommunicationKeyNotFound, roomID)
+}
+
+//storePushedCommunicationKeys caches a key set the server pushes after rotating its keys
+func (connect *TCPConnect) storePushedCommunicationKeys(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+	keys := model.MtsCommunicationKeys{}
+	if err := connect.codec().Unmarshal(mtsMessage.Data, &keys); err != nil {
+		fmt.Println("error decoding the pushed communication keys: ", err)
+		return
+	}
+
+	connect.KeyCache.Store(&keys)
+}
@@ -0,0 +1,64 @@
+package mtsclient
+
+import (
+	"errors"
+	"fmt"
+
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+)
+
+//ErrUnsupportedCompression is matched by every CompressionError
+var ErrUnsupportedCompression = errors.New("unsupported compression")
+
+//CompressionError fails a login whose response picks a compression the client did not offer or can not decode
+type CompressionError struct {
+	Compression string
+	Offered     []string
+}
+
+func (compressionError *CompressionError) Error() string {
+	return fmt.Sprintf("server picked compression %q, client offered %v", compressionError.Compression, compressionError.Offered)
+}
+
+//Is matches ErrUnsupportedCompression
+func (compressionError *CompressionError) Is(target error) bool {
+	return target == ErrUnsupportedCompression
+}
+
+//compressor is the frame compression of the current connection, nil when frames are not compressed
+func (connect *TCPConnect) compressor() helper.Compressor {
+	connect.connMutex.RLock()
+	defer connect.connMutex.RUnlock()
+
+	return connect.Compressor
+}
+
+//negotiateCompression records the server's choice, an algorithm the client did not offer fails the login
+func (connect *TCPConnect) negotiateCompression(compression string) error {
+	var compressor helper.Compressor
+	if compression != "" {
+		if !offered(connect.OfferedCompressions, compression) {
+			return &CompressionError{Compression: compression, Offered: connect.OfferedCompressions}
+		}
+
+		var err error
+		if compressor, err = helper.CompressorByName(compression); err != nil {
+			return &CompressionError{Compression: compression, Offered: connect.OfferedCompressions}
+		}
+	}
+
+	connect.connMutex.Lock()
+	connect.Compressor = compressor
+	connect.connMutex.Unlock()
+	return nil
+}
+
+func offered(compressions []string, compression string) bool {
+	for _, name := range compressions {
+		if name == compression {
+			return true
+		}
+	}
+
+	return false
+}
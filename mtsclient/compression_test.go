@@ -0,0 +1,54 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+)
+
+func TestLoginNegotiatesCompression(t *testing.T) {
+	tests := []struct {
+		name        string
+		offered     []string
+		picked      string
+		expectedErr error
+	}{
+		{name: "offered compression", offered: helper.SupportedCompressions(), picked: helper.Gzip.Name()},
+		{name: "no compression", offered: helper.SupportedCompressions()},
+		{name: "unknown compression", offered: helper.SupportedCompressions(), picked: "brotli", expectedErr: ErrUnsupportedCompression},
+		{name: "compression not offered", offered: []string{helper.Deflate.Name()}, picked: helper.Gzip.Name(), expectedErr: ErrUnsupportedCompression},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newLoginServer(t)
+			server.pickCompression(test.picked)
+			connect := server.client("alice", RMSIntegratorIdentity())
+			connect.OfferedCompressions = test.offered
+			defer connect.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := connect.ConnectAndLoginContext(ctx)
+			if test.expectedErr != nil {
+				if !errors.Is(err, test.expectedErr) {
+					t.Fatalf("expected %v, got %v", test.expectedErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("login: %v", err)
+			}
+
+			compressor := connect.compressor()
+			if test.picked == "" && compressor != nil || test.picked != "" && (compressor == nil || compressor.Name() != test.picked) {
+				t.Fatalf("expected compression %q, got %v", test.picked, compressor)
+			}
+		})
+	}
+}
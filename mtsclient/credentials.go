@@ -0,0 +1,263 @@
+package mtsclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+)
+
+var (
+	//ErrMissingCredentials is returned when a provider has no username or password to hand out
+	ErrMissingCredentials = errors.New("missing login credentials")
+	//ErrInsecureCredentialFile is returned when a credential or certificate file is readable by group or others
+	ErrInsecureCredentialFile = errors.New("credential file permissions too open")
+)
+
+const (
+	//DefaultUserNameEnv is the variable EnvCredentials reads the username from
+	DefaultUserNameEnv = "MTS_USERNAME"
+	//DefaultPasswordEnv is the variable EnvCredentials reads the password from
+	DefaultPasswordEnv = "MTS_PASSWORD"
+)
+
+//Credentials are the username and password for one password login
+//the password is a byte slice so it can be wiped once the login is sent
+type Credentials struct {
+	UserName string
+	Password []byte
+}
+
+//Zero overwrites the password in place
+func (credentials *Credentials) Zero() {
+	wipe(credentials.Password)
+	credentials.Password = nil
+}
+
+//CredentialProvider hands out fresh credentials for every password login, the client zeroes them after use
+type CredentialProvider interface {
+	Credentials(ctx context.Context) (*Credentials, error)
+}
+
+//StaticCredentials always returns the same username and password, meant for tests
+type StaticCredentials struct {
+	UserName string
+	Password string
+}
+
+//Credentials returns a copy of the static values
+func (provider StaticCredentials) Credentials(ctx context.Context) (*Credentials, error) {
+	if provider.UserName == "" || provider.Password == "" {
+		return nil, ErrMissingCredentials
+	}
+
+	return &Credentials{UserName: provider.UserName, Password: []byte(provider.Password)}, nil
+}
+
+//EnvCredentials reads the username and password from environment variables
+type EnvCredentials struct {
+	//UserNameEnv defaults to DefaultUserNameEnv
+	UserNameEnv string
+	//PasswordEnv defaults to DefaultPasswordEnv
+	PasswordEnv string
+}
+
+//Credentials reads the variables on every call so rotated values are picked up
+func (provider EnvCredentials) Credentials(ctx context.Context) (*Credentials, error) {
+	userNameEnv, passwordEnv := provider.UserNameEnv, provider.PasswordEnv
+	if userNameEnv == "" {
+		userNameEnv = DefaultUserNameEnv
+	}
+	if passwordEnv == "" {
+		passwordEnv = DefaultPasswordEnv
+	}
+
+	userName, password := os.Getenv(userNameEnv), os.Getenv(passwordEnv)
+	if userName == "" || password == "" {
+		return nil, fmt.Errorf("%w: set %s and %s", ErrMissingCredentials, userNameEnv, passwordEnv)
+	}
+
+	return &Credentials{UserName: userName, Password: []byte(password)}, nil
+}
+
+//FileCredentials reads {"username": "...", "password": "..."} from a file only its owner can read
+type FileCredentials struct {
+	Path string
+}
+
+//Credentials checks the file mode before reading it
+func (provider FileCredentials) Credentials(ctx context.Context) (*Credentials, error) {
+	info, err := os.Stat(provider.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkOwnerOnly(provider.Path, info); err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(provider.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(data)
+
+	return parseCredentials(data)
+}
+
+//CommandCredentials runs an external command, such as a secret manager CLI, that prints the credentials as JSON on stdout
+type CommandCredentials struct {
+	Name string
+	Args []string
+}
+
+//Credentials runs the command within the context
+func (provider CommandCredentials) Credentials(ctx context.Context) (*Credentials, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.CommandContext(ctx, provider.Name, provider.Args...)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err := command.Run()
+	defer wipe(stdout.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("credential command %s: %w: %s", provider.Name, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return parseCredentials(stdout.Bytes())
+}
+
+//checkOwnerOnly rejects a secret file that group or others can access
+func checkOwnerOnly(path string, info os.FileInfo) error {
+	//windows does not map its ACLs to the permission bits
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%w: %s is %s, expected 0600 or stricter", ErrInsecureCredentialFile, path, info.Mode().Perm())
+	}
+
+	return nil
+}
+
+type credentialDocument struct {
+	UserName string       `json:"username"`
+	Password secretString `json:"password"`
+}
+
+func parseCredentials(data []byte) (*Credentials, error) {
+	document := credentialDocument{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMissingCredentials, err)
+	}
+
+	if document.UserName == "" || len(document.Password) == 0 {
+		wipe(document.Password)
+		return nil, ErrMissingCredentials
+	}
+
+	return &Credentials{UserName: document.UserName, Password: document.Password}, nil
+}
+
+//passwordLogin mirrors model.MtsLogin with a Password encoded straight from the credential bytes the client wipes after marshalling
+type passwordLogin struct {
+	Username          *string
+	Password          secretString
+	AppID             enum.AppID
+	AppKey            []byte
+	ClientCertificate []byte
+	Compression       []string `json:",omitempty"`
+	MinVersion        byte     `json:",omitempty"`
+	MaxVersion        byte     `json:",omitempty"`
+}
+
+//secretString is a string kept in a byte slice the caller can wipe
+//it encodes as a string in every codec, the encoders still keep copies of their own in their buffers
+type secretString []byte
+
+//MarshalJSON escapes the secret without converting it to a string
+func (secret secretString) MarshalJSON() ([]byte, error) {
+	const hex = "0123456789abcdef"
+	data := make([]byte, 0, len(secret)+2)
+	data = append(data, '"')
+	for _, b := range secret {
+		switch {
+		case b == '"' || b == '\\':
+			data = append(data, '\\', b)
+		case b < 0x20:
+			data = append(data, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xf])
+		default:
+			data = append(data, b)
+		}
+	}
+
+	return append(data, '"'), nil
+}
+
+//MarshalMsgpack encodes the secret as a msgpack str
+func (secret secretString) MarshalMsgpack() ([]byte, error) {
+	var header []byte
+	switch length := len(secret); {
+	case length < 32:
+		header = []byte{0xa0 | byte(length)}
+	case length <= 0xff:
+		header = []byte{0xd9, byte(length)}
+	case length <= 0xffff:
+		header = []byte{0xda, 0, 0}
+		binary.BigEndian.PutUint16(header[1:], uint16(length))
+	default:
+		header = []byte{0xdb, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(header[1:], uint32(length))
+	}
+
+	return append(header, secret...), nil
+}
+
+//MarshalCBOR encodes the secret as a cbor text string
+func (secret secretString) MarshalCBOR() ([]byte, error) {
+	var header []byte
+	switch length := len(secret); {
+	case length < 24:
+		header = []byte{0x60 | byte(length)}
+	case length <= 0xff:
+		header = []byte{0x78, byte(length)}
+	case length <= 0xffff:
+		header = []byte{0x79, 0, 0}
+		binary.BigEndian.PutUint16(header[1:], uint16(length))
+	default:
+		header = []byte{0x7a, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(header[1:], uint32(length))
+	}
+
+	return append(header, secret...), nil
+}
+
+func (secret *secretString) UnmarshalJSON(data []byte) error {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return errors.New("password is not a JSON string")
+	}
+
+	//escaped strings go through the decoder, which leaves an unwipeable copy behind
+	if bytes.IndexByte(data, '\\') >= 0 {
+		var password string
+		if err := json.Unmarshal(data, &password); err != nil {
+			return err
+		}
+		*secret = []byte(password)
+		return nil
+	}
+
+	*secret = append([]byte(nil), data[1:len(data)-1]...)
+	return nil
+}
+
+func wipe(data []byte) {
+	for i := range data {
+		data[i] = 0
+	}
+}
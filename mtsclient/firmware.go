@@ -0,0 +1,351 @@
+package mtsclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+var (
+	//ErrFirmwareDigestMismatch is returned when the SHA-256 of the transferred image does not match
+	ErrFirmwareDigestMismatch = errors.New("firmware digest mismatch")
+	//ErrFirmwareResumeMismatch is returned when the peer acknowledged an offset the transfer can not continue from
+	ErrFirmwareResumeMismatch = errors.New("firmware resume offset mismatch")
+	//ErrFirmwareEmptyChunk is returned when the server answers a download request with no data before the final chunk
+	ErrFirmwareEmptyChunk = errors.New("firmware chunk empty before the final chunk")
+)
+
+const (
+	//DefaultFirmwareChunkSize is the chunk size used when the server did not negotiate an MTU
+	DefaultFirmwareChunkSize = 1 << 16
+	//firmwareFrameHeadroom is left under the MTU for a longer refreshed token and the compression overhead
+	firmwareFrameHeadroom = 256
+)
+
+//FirmwareTransfer tracks a chunked firmware transfer so it can resume after a reconnect
+type FirmwareTransfer struct {
+	TransferID string
+	//FirmwareID names the image to download
+	FirmwareID string
+	//ChunkSize caps the chunk size, 0 derives it from the negotiated MTU
+	ChunkSize int
+	//Offset is the number of bytes acknowledged so far
+	Offset int64
+	//Sequence is the number of chunks acknowledged so far
+	Sequence int
+	digest   hash.Hash
+	//pending is the upload chunk sent but not acknowledged yet, it is resent on resume
+	pending      []byte
+	pendingFinal bool
+	done         bool
+}
+
+//NewFirmwareTransfer is the ctor for a transfer starting at offset 0
+func NewFirmwareTransfer(transferID string, firmwareID string) *FirmwareTransfer {
+	return &FirmwareTransfer{
+		TransferID: transferID,
+		FirmwareID: firmwareID,
+		digest:     sha256.New(),
+	}
+}
+
+//Done reports whether the transfer finished and its digest was verified
+func (transfer *FirmwareTransfer) Done() bool {
+	return transfer.done
+}
+
+//UploadFirmware streams the image in sequenced chunks on the Firmware route, waiting for every ack
+//after a failure call it again with the same transfer and reader to resume from the last acknowledged chunk
+func (connect *TCPConnect) UploadFirmware(ctx context.Context, transfer *FirmwareTransfer, reader io.Reader) error {
+	transfer.init()
+	if transfer.Offset > 0 || transfer.pending != nil {
+		if err := connect.resumeUpload(ctx, transfer); err != nil {
+			return err
+		}
+	}
+
+	chunkSize, err := connect.firmwareChunkSize(transfer)
+	if err != nil {
+		return err
+	}
+
+	for !transfer.done {
+		if transfer.pending == nil {
+			chunk, final, err := readFirmwareChunk(reader, chunkSize)
+			if err != nil {
+				return err
+			}
+			transfer.pending, transfer.pendingFinal = chunk, final
+		}
+
+		if err := connect.sendFirmwareChunk(ctx, transfer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (connect *TCPConnect) sendFirmwareChunk(ctx context.Context, transfer *FirmwareTransfer) error {
+	chunk := model.MtsFirmwareChunk{
+		Operation:  enum.FirmwareUploadChunk,
+		TransferID: transfer.TransferID,
+		Sequence:   transfer.Sequence,
+		Offset:     transfer.Offset,
+		Data:       transfer.pending,
+		Final:      transfer.pendingFinal,
+	}
+
+	if chunk.Final {
+		digest, err := digestWith(transfer.digest, transfer.pending)
+		if err != nil {
+			return err
+		}
+		chunk.SHA256 = digest
+	}
+
+	ack, err := connect.firmwareAck(ctx, chunk)
+	if err != nil {
+		return err
+	}
+
+	if ack.NextOffset != transfer.Offset+int64(len(transfer.pending)) {
+		return fmt.Errorf("%w: sent up to %d, acknowledged %d", ErrFirmwareResumeMismatch, transfer.Offset+int64(len(transfer.pending)), ack.NextOffset)
+	}
+
+	return transfer.commitPending(ack)
+}
+
+//resumeUpload asks the server how far the upload got and drops the pending chunk when it already arrived
+func (connect *TCPConnect) resumeUpload(ctx context.Context, transfer *FirmwareTransfer) error {
+	ack, err := connect.firmwareAck(ctx, model.MtsFirmwareRequest{
+		Operation:  enum.FirmwareResume,
+		TransferID: transfer.TransferID,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch ack.NextOffset {
+	case transfer.Offset:
+		return nil
+	case transfer.Offset + int64(len(transfer.pending)):
+		if transfer.pending != nil {
+			//the chunk arrived but its ack was lost with the connection
+			return transfer.commitPending(ack)
+		}
+	}
+
+	return fmt.Errorf("%w: acknowledged %d, resumable at %d", ErrFirmwareResumeMismatch, transfer.Offset, ack.NextOffset)
+}
+
+func (connect *TCPConnect) firmwareAck(ctx context.Context, payload interface{}) (*model.MtsFirmwareAck, error) {
+	reply, err := connect.Call(ctx, enum.Firmware, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	ack := model.MtsFirmwareAck{}
+	if err = connect.codec().Unmarshal(reply.Data, &ack); err != nil {
+		return nil, err
+	}
+
+	return &ack, nil
+}
+
+//DownloadFirmware pulls the image chunk by chunk into the writer and verifies its SHA-256
+//after a failure call it again with the same transfer and writer to continue from transfer.Offset
+func (connect *TCPConnect) DownloadFirmware(ctx context.Context, transfer *FirmwareTransfer, writer io.Writer) error {
+	transfer.init()
+	chunkSize, err := connect.firmwareChunkSize(transfer)
+	if err != nil {
+		return err
+	}
+
+	for !transfer.done {
+		reply, err := connect.Call(ctx, enum.Firmware, model.MtsFirmwareRequest{
+			Operation:    enum.FirmwareDownloadChunk,
+			TransferID:   transfer.TransferID,
+			FirmwareID:   transfer.FirmwareID,
+			Offset:       transfer.Offset,
+			MaxChunkSize: chunkSize,
+		})
+		if err != nil {
+			return err
+		}
+
+		chunk := model.MtsFirmwareChunk{}
+		if err = connect.codec().Unmarshal(reply.Data, &chunk); err != nil {
+			return err
+		}
+
+		if chunk.Offset != transfer.Offset {
+			return fmt.Errorf("%w: asked for %d, received %d", ErrFirmwareResumeMismatch, transfer.Offset, chunk.Offset)
+		}
+
+		//asking again from the same offset would loop forever
+		if len(chunk.Data) == 0 && !chunk.Final {
+			return fmt.Errorf("%w: at offset %d", ErrFirmwareEmptyChunk, transfer.Offset)
+		}
+
+		if _, err = writer.Write(chunk.Data); err != nil {
+			return err
+		}
+
+		transfer.digest.Write(chunk.Data)
+		transfer.Offset += int64(len(chunk.Data))
+		transfer.Sequence++
+
+		if chunk.Final {
+			if !bytes.Equal(transfer.digest.Sum(nil), chunk.SHA256) {
+				return ErrFirmwareDigestMismatch
+			}
+			transfer.done = true
+		}
+	}
+
+	return nil
+}
+
+func (transfer *FirmwareTransfer) init() {
+	if transfer.digest == nil {
+		transfer.digest = sha256.New()
+	}
+}
+
+//commitPending moves the acknowledged chunk into the digest and the offsets
+func (transfer *FirmwareTransfer) commitPending(ack *model.MtsFirmwareAck) error {
+	transfer.digest.Write(transfer.pending)
+	transfer.Offset += int64(len(transfer.pending))
+	transfer.Sequence++
+
+	final := transfer.pendingFinal
+	transfer.pending, transfer.pendingFinal = nil, false
+
+	if final {
+		if !ack.Verified {
+			return ErrFirmwareDigestMismatch
+		}
+		transfer.done = true
+	}
+
+	return nil
+}
+
+//firmwareChunkSize is the largest chunk whose framed Firmware message stays under the negotiated MTS MTU
+//the codec may encode the chunk more than once, the JSON codec base64s the data inside the chunk and the chunk inside the MTSMessage,
+//so the size is measured on an encoded frame instead of being derived from the MTU
+func (connect *TCPConnect) firmwareChunkSize(transfer *FirmwareTransfer) (int, error) {
+	chunkSize := DefaultFirmwareChunkSize
+	if transfer.ChunkSize > 0 {
+		chunkSize = transfer.ChunkSize
+	}
+
+	mtuMts := connect.Session.MTU().Mts
+	if mtuMts <= 0 {
+		return chunkSize, nil
+	}
+
+	limit := mtuMts - firmwareFrameHeadroom
+	frameLength := 0
+	for chunkSize > 0 {
+		var err error
+		if frameLength, err = connect.firmwareFrameLength(transfer, chunkSize); err != nil {
+			return 0, err
+		}
+
+		if frameLength <= limit {
+			return chunkSize, nil
+		}
+
+		//shrink by the share of the frame that is over the limit, at least by one byte
+		next := int(int64(chunkSize) * int64(limit) / int64(frameLength))
+		if next >= chunkSize {
+			next = chunkSize - 1
+		}
+		chunkSize = next
+	}
+
+	//not even a one byte chunk fits
+	return 0, &MTUError{MTU: MtuMts, Route: enum.Firmware, Size: frameLength + firmwareFrameHeadroom, Limit: mtuMts}
+}
+
+//firmwareFrameLength encodes a final chunk of chunkSize bytes the way it goes on the wire, with the widest counters
+//the frame is not compressed, firmwareFrameHeadroom covers what compression adds to data it can not shrink
+func (connect *TCPConnect) firmwareFrameLength(transfer *FirmwareTransfer, chunkSize int) (int, error) {
+	data, err := connect.codec().Marshal(model.MtsFirmwareChunk{
+		Operation:  enum.FirmwareUploadChunk,
+		TransferID: transfer.TransferID,
+		Sequence:   math.MaxInt32,
+		Offset:     math.MaxInt64,
+		Data:       make([]byte, chunkSize),
+		Final:      true,
+		SHA256:     make([]byte, sha256.Size),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	mtsMessage := model.MTSMessage{
+		Version: connect.NegotiatedVersion(),
+		Route:   enum.Firmware,
+		SrcID:   connect.Session.NodeID(),
+		DstID:   MTSServer,
+		RPCID:   math.MaxInt32,
+		JWT:     connect.currentJWT(),
+		Data:    data,
+	}
+
+	msg, err := connect.codec().Marshal(&mtsMessage)
+	if err != nil {
+		return 0, err
+	}
+
+	frame, err := helper.PrepareFrame(connect.Framer, msg)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(frame), nil
+}
+
+//readFirmwareChunk reads up to chunkSize bytes, a short read marks the final chunk
+func readFirmwareChunk(reader io.Reader, chunkSize int) ([]byte, bool, error) {
+	chunk := make([]byte, chunkSize)
+	n, err := io.ReadFull(reader, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return chunk[:n], true, nil
+	}
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	return chunk, false, nil
+}
+
+//digestWith returns the SHA-256 of the acknowledged bytes plus the pending chunk without touching the running digest
+func digestWith(digest hash.Hash, pending []byte) ([]byte, error) {
+	state, err := digest.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	clone := sha256.New()
+	if err = clone.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+
+	clone.Write(pending)
+	return clone.Sum(nil), nil
+}
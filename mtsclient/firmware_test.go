@@ -0,0 +1,96 @@
+package mtsclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/codec"
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+func TestUploadFirmwareFitsTheMTU(t *testing.T) {
+	tests := []struct {
+		name      string
+		mtuMts    int
+		chunkSize int
+	}{
+		{name: "small mtu", mtuMts: 10000},
+		{name: "mtu below the chunk size", mtuMts: 1 << 15, chunkSize: 1 << 16},
+		{name: "chunk size below the mtu", mtuMts: 1 << 16, chunkSize: 1 << 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			image := make([]byte, 100000)
+			if _, err := rand.Read(image); err != nil {
+				t.Fatal(err)
+			}
+
+			server := newLoginServer(t)
+			server.announceMTU(test.mtuMts)
+			received, chunks := &bytes.Buffer{}, 0
+			server.handle(enum.Firmware, func(request model.MTSMessage) model.MTSMessage {
+				chunk := model.MtsFirmwareChunk{}
+				if err := json.Unmarshal(request.Data, &chunk); err != nil {
+					return helper.CreateErrorResponse(codec.JSON, enum.InvalidFormat, err.Error(), &request, enum.Firmware, nil, nil)
+				}
+
+				received.Write(chunk.Data)
+				chunks++
+				digest := sha256.Sum256(received.Bytes())
+				data, _ := json.Marshal(model.MtsFirmwareAck{
+					TransferID: chunk.TransferID,
+					Sequence:   chunk.Sequence,
+					NextOffset: int64(received.Len()),
+					Verified:   chunk.Final && bytes.Equal(digest[:], chunk.SHA256),
+				})
+				return helper.CreateResponse(&request, enum.Firmware, nil, false, nil, data)
+			})
+
+			connect := server.client("alice", RMSIntegratorIdentity())
+			defer connect.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := connect.ConnectAndLoginContext(ctx); err != nil {
+				t.Fatalf("login: %v", err)
+			}
+
+			transfer := NewFirmwareTransfer("transfer-1", "firmware-1")
+			transfer.ChunkSize = test.chunkSize
+			if err := connect.UploadFirmware(ctx, transfer, bytes.NewReader(image)); err != nil {
+				t.Fatalf("upload: %v", err)
+			}
+
+			if !transfer.Done() || !bytes.Equal(received.Bytes(), image) {
+				t.Fatalf("upload incomplete, %d of %d bytes stored", received.Len(), len(image))
+			}
+
+			if largest := server.largestFrameLength(); largest > test.mtuMts {
+				t.Fatalf("largest frame %d bytes is over the MTU of %d", largest, test.mtuMts)
+			}
+
+			if test.chunkSize > 0 && test.chunkSize < test.mtuMts && chunks != (len(image)+test.chunkSize-1)/test.chunkSize {
+				t.Fatalf("the configured chunk size was not kept, %d chunks", chunks)
+			}
+			t.Logf("%d chunks, largest frame %d bytes", chunks, server.largestFrameLength())
+		})
+	}
+}
+
+func TestFirmwareChunkSizeReportsAnMTUTooSmall(t *testing.T) {
+	connect := NewTCPConnect("127.0.0.1", 0, 1000)
+	connect.Session.setMTU(MTU{Mts: 300})
+
+	if _, err := connect.firmwareChunkSize(NewFirmwareTransfer("transfer-1", "firmware-1")); !errors.Is(err, ErrMTUExceeded) {
+		t.Fatalf("expected an MTUError, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package mtsclient
+
+import (
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+)
+
+//defaultRMSAppKey is the app key of the RMS integrator, RMSIntegratorIdentity hands out copies of it
+var defaultRMSAppKey = [...]byte{79, 157, 102, 210, 83, 34, 156, 117, 223, 190, 187, 27, 28, 63, 94, 214, 4, 98, 123, 98, 65, 20, 143, 60, 50, 62, 162, 115, 7, 46, 119, 8}
+
+//ClientIdentity is who the client logs in as and the node ID its requests come from
+type ClientIdentity struct {
+	AppID  enum.AppID
+	AppKey []byte
+	//NodeID is the SrcID of every request the client sends
+	NodeID int
+}
+
+//RMSIntegratorIdentity is the default identity, an RMS integrator on the MTS RMS Server node
+func RMSIntegratorIdentity() ClientIdentity {
+	return ClientIdentity{
+		AppID:  enum.RMSServer,
+		AppKey: append([]byte(nil), defaultRMSAppKey[:]...),
+		NodeID: MTSRMSServer,
+	}
+}
+
+//RMSEmulatorIdentity logs in as an RMS emulator, it talks to the server from the RMS node like an integrator
+func RMSEmulatorIdentity(appKey []byte) ClientIdentity {
+	return ClientIdentity{
+		AppID:  enum.RMSEmulator,
+		AppKey: append([]byte(nil), appKey...),
+		NodeID: MTSRMSServer,
+	}
+}
+
+//BTPPIdentity logs in as a bluetooth portable programmer on the provisioner node
+func BTPPIdentity(appKey []byte) ClientIdentity {
+	return ClientIdentity{
+		AppID:  enum.BTPP,
+		AppKey: append([]byte(nil), appKey...),
+		NodeID: MTSProvisioner,
+	}
+}
+
+//MobilePPIdentity logs in as a mobile portable programmer on the provisioner node
+func MobilePPIdentity(appKey []byte) ClientIdentity {
+	return ClientIdentity{
+		AppID:  enum.MobilePP,
+		AppKey: append([]byte(nil), appKey...),
+		NodeID: MTSProvisioner,
+	}
+}
+
+//WithIdentity switches the app the client logs in as, call it before connecting
+//the issued certificate and token belong to the previous identity so they are dropped
+func (connect *TCPConnect) WithIdentity(identity ClientIdentity) {
+	connect.Session = NewSession(identity)
+	connect.KeyCache.Invalidate()
+}
@@ -0,0 +1,191 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//ErrRouteNotAllowed is returned by AllowRoutesSend for routes outside the allow list
+var ErrRouteNotAllowed = errors.New("route not allowed")
+
+//Middleware wraps the inbound handler chain
+type Middleware func(next HandlerFunc) HandlerFunc
+
+//SendFunc writes one outbound message
+type SendFunc func(ctx context.Context, mtsMessage *model.MTSMessage) error
+
+//SendMiddleware wraps the outbound send chain
+type SendMiddleware func(next SendFunc) SendFunc
+
+//chainHandler wraps the handler so the first middleware runs first
+func chainHandler(middlewares []Middleware, handler HandlerFunc) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+//chainSend wraps the send so the first middleware runs first
+func chainSend(middlewares []SendMiddleware, send SendFunc) SendFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		send = middlewares[i](send)
+	}
+
+	return send
+}
+
+//Recovery turns a panicking handler into a SystemError reply instead of killing the read loop
+func Recovery() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("handler for %s rpcId %d panicked: %v", mtsMessage.Route, mtsMessage.RPCID, r)
+					if !mtsMessage.Reply {
+						responseWriter.ReplyError(enum.SystemError, enum.MtsErrorID.String(enum.SystemError))
+					}
+				}
+			}()
+
+			next(responseWriter, mtsMessage)
+		}
+	}
+}
+
+//RecoverySend turns a panic while sending into an error
+func RecoverySend() SendMiddleware {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, mtsMessage *model.MTSMessage) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("sending %s rpcId %d panicked: %v", mtsMessage.Route, mtsMessage.RPCID, r)
+				}
+			}()
+
+			return next(ctx, mtsMessage)
+		}
+	}
+}
+
+//Logging writes one key=value line per inbound message
+func Logging(logger *log.Logger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+			logger.Printf("direction=inbound %s", messageFields(mtsMessage))
+			next(responseWriter, mtsMessage)
+		}
+	}
+}
+
+//LoggingSend writes one key=value line per outbound message, including the send error
+func LoggingSend(logger *log.Logger) SendMiddleware {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, mtsMessage *model.MTSMessage) error {
+			err := next(ctx, mtsMessage)
+			logger.Printf("direction=outbound %s error=%q", messageFields(mtsMessage), errorString(err))
+			return err
+		}
+	}
+}
+
+//InjectJWT stamps the current session token on outbound messages that do not carry one, login requests go out without it
+func InjectJWT(token func() *string) SendMiddleware {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, mtsMessage *model.MTSMessage) error {
+			if mtsMessage.Route != enum.Login && (mtsMessage.JWT == nil || *mtsMessage.JWT == "") {
+				mtsMessage.JWT = token()
+			}
+
+			return next(ctx, mtsMessage)
+		}
+	}
+}
+
+//Latency reports how long each inbound handler took
+func Latency(observe func(route enum.MTSRequest, elapsed time.Duration)) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+			start := time.Now()
+			next(responseWriter, mtsMessage)
+			observe(mtsMessage.Route, time.Since(start))
+		}
+	}
+}
+
+//LatencySend reports how long each outbound send took
+func LatencySend(observe func(route enum.MTSRequest, elapsed time.Duration)) SendMiddleware {
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, mtsMessage *model.MTSMessage) error {
+			start := time.Now()
+			err := next(ctx, mtsMessage)
+			observe(mtsMessage.Route, time.Since(start))
+			return err
+		}
+	}
+}
+
+//AllowRoutes rejects inbound requests outside the listed routes with an InvalidRequest reply
+func AllowRoutes(routes ...enum.MTSRequest) Middleware {
+	allowed := routeSet(routes)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+			if !allowed[mtsMessage.Route] {
+				log.Print("Route not allowed : ", mtsMessage.Route)
+				if !mtsMessage.Reply {
+					responseWriter.ReplyError(enum.InvalidRequest, enum.MtsErrorID.String(enum.InvalidRequest))
+				}
+				return
+			}
+
+			next(responseWriter, mtsMessage)
+		}
+	}
+}
+
+//AllowRoutesSend fails outbound messages outside the listed routes with ErrRouteNotAllowed
+func AllowRoutesSend(routes ...enum.MTSRequest) SendMiddleware {
+	allowed := routeSet(routes)
+	return func(next SendFunc) SendFunc {
+		return func(ctx context.Context, mtsMessage *model.MTSMessage) error {
+			if !allowed[mtsMessage.Route] {
+				return fmt.Errorf("%w: %s", ErrRouteNotAllowed, mtsMessage.Route)
+			}
+
+			return next(ctx, mtsMessage)
+		}
+	}
+}
+
+func routeSet(routes []enum.MTSRequest) map[enum.MTSRequest]bool {
+	allowed := map[enum.MTSRequest]bool{}
+	for _, route := range routes {
+		allowed[route] = true
+	}
+
+	return allowed
+}
+
+func messageFields(mtsMessage *model.MTSMessage) string {
+	attributeRoute := ""
+	if mtsMessage.AttributeRoute != nil {
+		attributeRoute = *mtsMessage.AttributeRoute
+	}
+
+	return fmt.Sprintf("route=%s attributeRoute=%q rpcId=%d src=%d dst=%d reply=%t error=%t bytes=%d",
+		mtsMessage.Route, attributeRoute, mtsMessage.RPCID, mtsMessage.SrcID, mtsMessage.DstID, mtsMessage.Reply, mtsMessage.IsError, len(mtsMessage.Data))
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
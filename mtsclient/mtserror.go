@@ -0,0 +1,70 @@
+package mtsclient
+
+import (
+	"fmt"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//MtsError is the error carried by an MTSMessage with IsError set
+type MtsError struct {
+	ID      enum.MtsErrorID
+	Message string
+	//Route and RPCID identify the message the server rejected
+	Route enum.MTSRequest
+	RPCID int
+}
+
+var (
+	//ErrSystemError matches MtsErrors with enum.SystemError
+	ErrSystemError = &MtsError{ID: enum.SystemError}
+	//ErrInvalidLogin matches MtsErrors with enum.InvalidLogin
+	ErrInvalidLogin = &MtsError{ID: enum.InvalidLogin}
+	//ErrInvalidAppKey matches MtsErrors with enum.InvalidAppKey
+	ErrInvalidAppKey = &MtsError{ID: enum.InvalidAppKey}
+	//ErrInvalidAppID matches MtsErrors with enum.InvalidAppID
+	ErrInvalidAppID = &MtsError{ID: enum.InvalidAppID}
+	//ErrInvalidRequest matches MtsErrors with enum.InvalidRequest
+	ErrInvalidRequest = &MtsError{ID: enum.InvalidRequest}
+	//ErrUnroutableMessage matches MtsErrors with enum.UnroutableMessage
+	ErrUnroutableMessage = &MtsError{ID: enum.UnroutableMessage}
+	//ErrInvalidFormat matches MtsErrors with enum.InvalidFormat
+	ErrInvalidFormat = &MtsError{ID: enum.InvalidFormat}
+	//ErrInvalidJWT matches MtsErrors with enum.InvalidJWT
+	ErrInvalidJWT = &MtsError{ID: enum.InvalidJWT}
+)
+
+func (mtsError *MtsError) Error() string {
+	if mtsError.Message == "" {
+		return fmt.Sprintf("mts error %s on %s rpcId %d", mtsError.ID, mtsError.Route, mtsError.RPCID)
+	}
+
+	return fmt.Sprintf("mts error %s on %s rpcId %d: %s", mtsError.ID, mtsError.Route, mtsError.RPCID, mtsError.Message)
+}
+
+//Is matches any MtsError with the same error ID, so errors.Is(err, ErrInvalidJWT) works on decoded errors
+func (mtsError *MtsError) Is(target error) bool {
+	targetError, ok := target.(*MtsError)
+	return ok && targetError.ID == mtsError.ID
+}
+
+//decodeMtsError reads the MtsErrorResponse body of an error message
+func (connect *TCPConnect) decodeMtsError(mtsMessage *model.MTSMessage) *MtsError {
+	errorResponse := model.MtsErrorResponse{}
+	if err := connect.codec().Unmarshal(mtsMessage.Data, &errorResponse); err != nil {
+		return &MtsError{
+			ID:      enum.SystemError,
+			Message: fmt.Sprintf("undecodable error response: %v", err),
+			Route:   mtsMessage.Route,
+			RPCID:   mtsMessage.RPCID,
+		}
+	}
+
+	return &MtsError{
+		ID:      errorResponse.MtsError,
+		Message: errorResponse.MtsErrorMessage,
+		Route:   mtsMessage.Route,
+		RPCID:   mtsMessage.RPCID,
+	}
+}
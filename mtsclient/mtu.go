@@ -0,0 +1,89 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//ErrMTUExceeded is matched by every MTUError
+var ErrMTUExceeded = errors.New("mtu exceeded")
+
+const (
+	//MtuOpl names the limit on the Data of an OPL payload
+	MtuOpl = "MtuOpl"
+	//MtuMts names the limit on a whole frame
+	MtuMts = "MtuMts"
+)
+
+//MTU are the limits the server announced in the login response, 0 means no limit was announced
+type MTU struct {
+	Opl int
+	Mts int
+	//Bluetooth is kept for the portable programmer roles, the MTS connection itself never checks it
+	Bluetooth int
+}
+
+//MTUError is returned before anything is written when a message is larger than the negotiated MTU
+type MTUError struct {
+	//MTU is MtuOpl or MtuMts
+	MTU   string
+	Route enum.MTSRequest
+	Size  int
+	Limit int
+}
+
+func (mtuError *MTUError) Error() string {
+	return fmt.Sprintf("%s exceeded on %s: %d bytes, limit %d", mtuError.MTU, mtuError.Route, mtuError.Size, mtuError.Limit)
+}
+
+//Is matches ErrMTUExceeded
+func (mtuError *MTUError) Is(target error) bool {
+	return target == ErrMTUExceeded
+}
+
+//SendOPLPayloadContext sends the OPL payload on the route, Data over MtuOpl is rejected with an MTUError
+//the protocol has no way to reassemble a split lock command, so oversized payloads are never fragmented
+func (connect *TCPConnect) SendOPLPayloadContext(ctx context.Context, route enum.MTSRequest, mtsOPLPayload *model.MtsOplPayload) error {
+	if limit := connect.Session.MTU().Opl; limit > 0 && len(mtsOPLPayload.Data) > limit {
+		return &MTUError{MTU: MtuOpl, Route: route, Size: len(mtsOPLPayload.Data), Limit: limit}
+	}
+
+	return connect.sendOPLPayload(ctx, route, mtsOPLPayload)
+}
+
+func (connect *TCPConnect) sendOPLPayload(ctx context.Context, route enum.MTSRequest, mtsOPLPayload *model.MtsOplPayload) error {
+	strMtsOPLPayload, err := connect.codec().Marshal(mtsOPLPayload)
+	if err != nil {
+		fmt.Println("error occured in marshalling the OPLpayload data")
+		fmt.Println(err)
+		return err
+	}
+
+	mtsOPLMessage := helper.CreateRequest(
+		&connect.RPCIDs,
+		route,
+		nil,
+		connect.Session.NodeID(),
+		MTSServer,
+		false,
+		nil,
+		strMtsOPLPayload,
+	)
+
+	return connect.SendDataToServerContext(ctx, mtsOPLMessage)
+}
+
+//checkFrameMTU catches frames over MtuMts before they are queued
+func (connect *TCPConnect) checkFrameMTU(mtsMessage *model.MTSMessage, frameLength int) error {
+	limit := connect.Session.MTU().Mts
+	if limit <= 0 || frameLength <= limit {
+		return nil
+	}
+
+	return &MTUError{MTU: MtuMts, Route: mtsMessage.Route, Size: frameLength, Limit: limit}
+}
@@ -0,0 +1,46 @@
+package mtsclient
+
+import (
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//DefaultRoutePriorities puts login and ping traffic in the control lane and the large transfers in the bulk lane
+//routes missing from the map go in the OPL lane
+func DefaultRoutePriorities() map[enum.MTSRequest]enum.SendPriority {
+	return map[enum.MTSRequest]enum.SendPriority{
+		enum.ErrorResponse:   enum.ControlPriority,
+		enum.Login:           enum.ControlPriority,
+		enum.LoginResponse:   enum.ControlPriority,
+		enum.RMSPing:         enum.ControlPriority,
+		enum.RMSPingResponse: enum.ControlPriority,
+		enum.OPL:             enum.OPLPriority,
+		enum.OplCommands:     enum.OPLPriority,
+		enum.Firmware:        enum.BulkPriority,
+		enum.RoomsMap:        enum.BulkPriority,
+	}
+}
+
+//SetRoutePriority moves every message sent on the route to the given lane
+func (connect *TCPConnect) SetRoutePriority(route enum.MTSRequest, priority enum.SendPriority) {
+	connect.routeMutex.Lock()
+	defer connect.routeMutex.Unlock()
+
+	connect.routePriorities[route] = priority
+}
+
+//priorityOf picks the lane for the message, error responses always go in the control lane
+func (connect *TCPConnect) priorityOf(mtsMessage *model.MTSMessage) enum.SendPriority {
+	if mtsMessage.IsError {
+		return enum.ControlPriority
+	}
+
+	connect.routeMutex.RLock()
+	defer connect.routeMutex.RUnlock()
+
+	if priority, ok := connect.routePriorities[mtsMessage.Route]; ok {
+		return priority
+	}
+
+	return enum.OPLPriority
+}
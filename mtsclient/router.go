@@ -0,0 +1,166 @@
+package mtsclient
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//ResponseWriter replies to the message being handled
+type ResponseWriter interface {
+	//Reply answers the request on the route with the payload, []byte payloads are sent as is
+	//replying on enum.UseAttributeRoute keeps the attribute route of the request
+	Reply(route enum.MTSRequest, payload interface{}) error
+	//ReplyError answers the request with an MtsErrorResponse
+	ReplyError(errorID enum.MtsErrorID, errorMsg string) error
+}
+
+//HandlerFunc handles one inbound message
+//every pushed message is handled on its own goroutine, so a handler may Call the server and handlers run concurrently
+type HandlerFunc func(responseWriter ResponseWriter, mtsMessage *model.MTSMessage)
+
+//Router dispatches inbound messages to the handler registered for their route
+type Router struct {
+	mutex             sync.RWMutex
+	handlers          map[enum.MTSRequest]HandlerFunc
+	attributeHandlers map[string]HandlerFunc
+	middlewares       []Middleware
+	//NotFound handles requests without a registered handler, defaults to an InvalidRequest error reply
+	NotFound HandlerFunc
+}
+
+//NewRouter is the ctor that instantiates an empty router
+func NewRouter() *Router {
+	return &Router{
+		handlers:          map[enum.MTSRequest]HandlerFunc{},
+		attributeHandlers: map[string]HandlerFunc{},
+		NotFound:          replyInvalidRequest,
+	}
+}
+
+//Handle registers the handler for the route, replacing any previous one
+func (router *Router) Handle(route enum.MTSRequest, handler HandlerFunc) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	router.handlers[route] = handler
+}
+
+//HandleAttribute registers the handler for messages sent on enum.UseAttributeRoute with the attribute route
+func (router *Router) HandleAttribute(attributeRoute string, handler HandlerFunc) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	router.attributeHandlers[attributeRoute] = handler
+}
+
+//Use appends middlewares around every dispatched message, the first one runs outermost
+func (router *Router) Use(middlewares ...Middleware) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	router.middlewares = append(router.middlewares, middlewares...)
+}
+
+//Dispatch runs the handler registered for the message route through the middlewares
+func (router *Router) Dispatch(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+	router.mutex.RLock()
+	handler := router.resolve(mtsMessage)
+	middlewares := router.middlewares
+	router.mutex.RUnlock()
+
+	chainHandler(middlewares, handler)(responseWriter, mtsMessage)
+}
+
+func (router *Router) resolve(mtsMessage *model.MTSMessage) HandlerFunc {
+	if mtsMessage.Route == enum.UseAttributeRoute && mtsMessage.AttributeRoute != nil {
+		if handler, ok := router.attributeHandlers[*mtsMessage.AttributeRoute]; ok {
+			return handler
+		}
+	}
+
+	if handler, ok := router.handlers[mtsMessage.Route]; ok {
+		return handler
+	}
+
+	//a reply nobody waits for any more must not be answered with an error
+	if mtsMessage.Reply {
+		return dropReply
+	}
+
+	if router.NotFound != nil {
+		return router.NotFound
+	}
+
+	return dropReply
+}
+
+func dropReply(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+	log.Print("Dropping unexpected message : ", mtsMessage.Route, " rpcId ", mtsMessage.RPCID)
+}
+
+func replyInvalidRequest(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+	log.Print("Unknown message : ", mtsMessage.Route)
+	if err := responseWriter.ReplyError(enum.InvalidRequest, enum.MtsErrorID.String(enum.InvalidRequest)); err != nil {
+		fmt.Println("error replying to unknown message: ", err)
+	}
+}
+
+//messageResponseWriter sends the replies for one inbound message
+type messageResponseWriter struct {
+	connect *TCPConnect
+	request *model.MTSMessage
+	//err is the first reply that failed to send
+	err error
+}
+
+func (responseWriter *messageResponseWriter) Reply(route enum.MTSRequest, payload interface{}) error {
+	data, err := responseWriter.connect.encodePayload(payload)
+	if err != nil {
+		return responseWriter.failed(err)
+	}
+
+	var attributeRoute *string
+	if route == enum.UseAttributeRoute {
+		attributeRoute = responseWriter.request.AttributeRoute
+	}
+
+	msgResponse := helper.CreateResponse(responseWriter.request, route, attributeRoute, false, nil, data)
+	return responseWriter.failed(responseWriter.connect.SendDataToServer(msgResponse))
+}
+
+func (responseWriter *messageResponseWriter) ReplyError(errorID enum.MtsErrorID, errorMsg string) error {
+	request := responseWriter.request
+	responseMsg := helper.CreateErrorResponse(responseWriter.connect.codec(), errorID, errorMsg, request, request.Route, request.AttributeRoute, nil)
+	return responseWriter.failed(responseWriter.connect.SendDataToServer(responseMsg))
+}
+
+func (responseWriter *messageResponseWriter) failed(err error) error {
+	if responseWriter.err == nil {
+		responseWriter.err = err
+	}
+	return err
+}
+
+//defaultRouter answers the routes the client has always handled itself
+func (connect *TCPConnect) defaultRouter() *Router {
+	router := NewRouter()
+	router.Use(Recovery())
+	router.Handle(enum.LoginResponse, func(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+		connect.ExtractCertData(*mtsMessage)
+	})
+	router.Handle(enum.OPL, func(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+		log.Println("received OPL response: ", string(mtsMessage.Data))
+	})
+	router.Handle(enum.RMSCommunicationKeys, connect.storePushedCommunicationKeys)
+	router.Handle(enum.PPCommunicationKeys, connect.storePushedCommunicationKeys)
+	router.Handle(enum.RMSPing, func(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+		log.Print("Received RMS Ping request. Sending RMS Ping response.")
+		if err := responseWriter.Reply(enum.RMSPingResponse, make([]byte, 4)); err != nil {
+			fmt.Println("error sending the ping response: ", err)
+		}
+	})
+
+	return router
+}
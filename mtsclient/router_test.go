@@ -0,0 +1,52 @@
+package mtsclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+func TestHandlerCanCallTheServer(t *testing.T) {
+	server := newLoginServer(t)
+	//an OPL message makes the server push a RoomsMap request, whose handler calls back for the devices
+	server.handle(enum.OPL, func(request model.MTSMessage) model.MTSMessage {
+		return model.MTSMessage{Version: helper.ProtocolVersion1, Route: enum.RoomsMap, RPCID: 1 << 20}
+	})
+	server.handle(enum.RMSDevices, func(request model.MTSMessage) model.MTSMessage {
+		return helper.CreateResponse(&request, enum.RMSDevices, nil, false, nil, []byte(`["device-1"]`))
+	})
+
+	connect := server.client("alice", RMSIntegratorIdentity())
+	defer connect.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	called := make(chan error, 1)
+	connect.Router.Handle(enum.RoomsMap, func(responseWriter ResponseWriter, mtsMessage *model.MTSMessage) {
+		_, err := connect.Call(ctx, enum.RMSDevices, []byte(`{}`))
+		called <- err
+	})
+
+	if err := connect.ConnectAndLoginContext(ctx); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	request := helper.CreateRequest(&connect.RPCIDs, enum.OPL, nil, connect.Session.NodeID(), MTSServer, false, nil, []byte(`{}`))
+	if err := connect.SendDataToServerContext(ctx, request); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	select {
+	case err := <-called:
+		if err != nil {
+			t.Fatalf("call from the handler: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("the handler never got the reply to its call")
+	}
+}
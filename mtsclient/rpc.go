@@ -0,0 +1,166 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//ErrConnectionLost fails the calls still waiting when their connection goes away
+var ErrConnectionLost = errors.New("connection lost")
+
+//pendingCalls is the table of requests waiting for their reply, keyed by RPCID
+type pendingCalls struct {
+	mutex sync.Mutex
+	calls map[int]chan callResult
+}
+
+type callResult struct {
+	reply *model.MTSMessage
+	err   error
+}
+
+func newPendingCalls() *pendingCalls {
+	return &pendingCalls{
+		calls: map[int]chan callResult{},
+	}
+}
+
+func (pending *pendingCalls) register(rpcID int) chan callResult {
+	result := make(chan callResult, 1)
+
+	pending.mutex.Lock()
+	defer pending.mutex.Unlock()
+	pending.calls[rpcID] = result
+	return result
+}
+
+func (pending *pendingCalls) remove(rpcID int) {
+	pending.mutex.Lock()
+	defer pending.mutex.Unlock()
+	delete(pending.calls, rpcID)
+}
+
+//resolve hands the reply to its caller, returns false when nobody is waiting for the RPCID
+func (pending *pendingCalls) resolve(reply *model.MTSMessage) bool {
+	pending.mutex.Lock()
+	result, ok := pending.calls[reply.RPCID]
+	delete(pending.calls, reply.RPCID)
+	pending.mutex.Unlock()
+
+	if ok {
+		result <- callResult{reply: reply}
+	}
+	return ok
+}
+
+//fail fails the call waiting for the RPCID, returns false when nobody is waiting for it
+func (pending *pendingCalls) fail(rpcID int, err error) bool {
+	pending.mutex.Lock()
+	result, ok := pending.calls[rpcID]
+	delete(pending.calls, rpcID)
+	pending.mutex.Unlock()
+
+	if ok {
+		result <- callResult{err: err}
+	}
+	return ok
+}
+
+//failAll fails every waiting call, used when the connection carrying them is gone
+func (pending *pendingCalls) failAll(err error) {
+	pending.mutex.Lock()
+	calls := pending.calls
+	pending.calls = map[int]chan callResult{}
+	pending.mutex.Unlock()
+
+	for _, result := range calls {
+		result <- callResult{err: err}
+	}
+}
+
+//Call sends a request on the route and waits for the reply with the same RPCID
+//payload is encoded with the client codec, []byte payloads are sent as is
+func (connect *TCPConnect) Call(ctx context.Context, route enum.MTSRequest, payload interface{}) (*model.MTSMessage, error) {
+	return connect.call(ctx, route, nil, payload)
+}
+
+//CallWithAttributeRoute is Call for features only reachable through a string attribute route
+func (connect *TCPConnect) CallWithAttributeRoute(ctx context.Context, attributeRoute string, payload interface{}) (*model.MTSMessage, error) {
+	return connect.call(ctx, enum.UseAttributeRoute, &attributeRoute, payload)
+}
+
+func (connect *TCPConnect) call(ctx context.Context, route enum.MTSRequest, attributeRoute *string, payload interface{}) (*model.MTSMessage, error) {
+	ctx, cancel := connect.withDefaultTimeout(ctx)
+	defer cancel()
+
+	data, err := connect.encodePayload(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	request := helper.CreateRequest(
+		&connect.RPCIDs,
+		route,
+		attributeRoute,
+		connect.Session.NodeID(),
+		MTSServer,
+		false,
+		nil,
+		data,
+	)
+
+	stale := connect.Tokens.Current()
+	reply, err := connect.roundTrip(ctx, request)
+	if errors.Is(err, ErrInvalidJWT) && route != enum.Login {
+		//the token expired or was revoked under the call, refresh it and try once more
+		if refreshErr := connect.Tokens.refresh(ctx, stale); refreshErr != nil {
+			return reply, fmt.Errorf("%w, token refresh failed: %v", err, refreshErr)
+		}
+
+		request.RPCID = connect.RPCIDs.Next()
+		reply, err = connect.roundTrip(ctx, request)
+	}
+
+	return reply, err
+}
+
+//roundTrip registers the request before sending it so a fast reply can not be missed
+func (connect *TCPConnect) roundTrip(ctx context.Context, request model.MTSMessage) (*model.MTSMessage, error) {
+	result := connect.pending.register(request.RPCID)
+	defer connect.pending.remove(request.RPCID)
+
+	if err := connect.SendDataToServerContext(ctx, request); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.err != nil {
+			return nil, res.err
+		}
+
+		if res.reply.IsError {
+			return res.reply, connect.decodeMtsError(res.reply)
+		}
+		return res.reply, nil
+	}
+}
+
+func (connect *TCPConnect) encodePayload(payload interface{}) ([]byte, error) {
+	switch data := payload.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return data, nil
+	default:
+		return connect.codec().Marshal(payload)
+	}
+}
@@ -0,0 +1,312 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+)
+
+var (
+	//ErrQueueFull is returned by FailWhenFull sends when the outbound queue has no room
+	ErrQueueFull = errors.New("send queue full")
+	//ErrDroppedFromQueue is returned to the sender whose message DropOldestWhenFull evicted
+	ErrDroppedFromQueue = errors.New("dropped from send queue")
+	//ErrQueueClosed is returned for messages still queued when the client is closed
+	ErrQueueClosed = errors.New("send queue closed")
+)
+
+//DefaultSendQueueCapacity is the number of frames waiting for the writer before the full policy kicks in
+//control frames are always queued, so they can take the depth past the capacity
+const DefaultSendQueueCapacity = 256
+
+//SendQueueStats is a snapshot of the outbound queue for sizing it
+type SendQueueStats struct {
+	Depth int
+	//LaneDepths is the depth of every lane, indexed by enum.SendPriority
+	LaneDepths []int
+	Capacity   int
+	Enqueued   uint64
+	Sent       uint64
+	Dropped    uint64
+	Rejected   uint64
+	//TotalWait and MaxWait measure the time frames spent queued before the writer picked them up
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+//outboundFrame is one framed message waiting for the writer goroutine
+type outboundFrame struct {
+	ctx      context.Context
+	priority enum.SendPriority
+	data     []byte
+	enqueued time.Time
+	done     chan error
+	//secret frames are wiped once the writer is done with them
+	secret bool
+}
+
+//finish hands the result to the sender, the writer goroutine owns the frame until then
+func (frame *outboundFrame) finish(err error) {
+	if frame.secret {
+		wipe(frame.data)
+	}
+	frame.done <- err
+}
+
+//SendQueue feeds a single writer goroutine so concurrent senders never interleave bytes on the wire
+//frames are kept in one lane per priority and the writer always drains the highest priority lane first
+type SendQueue struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	lanes    [enum.SendPriorityCount][]*outboundFrame
+	depth    int
+	capacity int
+	policy   enum.QueueFullPolicy
+	write    func(frame *outboundFrame) error
+	closed   bool
+	//held keeps the OPL and bulk lanes queued while the connection is not logged in, control frames still go out
+	held  bool
+	stats SendQueueStats
+}
+
+//newSendQueue starts the writer goroutine, write is only ever called from it
+func newSendQueue(capacity int, policy enum.QueueFullPolicy, write func(frame *outboundFrame) error) *SendQueue {
+	queue := &SendQueue{
+		capacity: capacity,
+		policy:   policy,
+		write:    write,
+	}
+	queue.cond = sync.NewCond(&queue.mutex)
+
+	go queue.run()
+	return queue
+}
+
+//Stats returns a snapshot of the queue counters
+func (queue *SendQueue) Stats() SendQueueStats {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	stats := queue.stats
+	stats.Depth = queue.depth
+	stats.LaneDepths = make([]int, len(queue.lanes))
+	for priority, lane := range queue.lanes {
+		stats.LaneDepths[priority] = len(lane)
+	}
+	stats.Capacity = queue.capacity
+	return stats
+}
+
+//Send queues the frame in its priority lane according to the full policy and waits until the writer has written it
+func (queue *SendQueue) Send(ctx context.Context, priority enum.SendPriority, data []byte) error {
+	return queue.send(ctx, priority, data, false)
+}
+
+func (queue *SendQueue) send(ctx context.Context, priority enum.SendPriority, data []byte, secret bool) error {
+	if priority < 0 || int(priority) >= len(queue.lanes) {
+		priority = enum.OPLPriority
+	}
+
+	frame := &outboundFrame{
+		ctx:      ctx,
+		priority: priority,
+		data:     data,
+		enqueued: time.Now(),
+		done:     make(chan error, 1),
+		secret:   secret,
+	}
+
+	if err := queue.enqueue(frame); err != nil {
+		if secret {
+			wipe(data)
+		}
+		return err
+	}
+
+	select {
+	case err := <-frame.done:
+		return err
+	case <-ctx.Done():
+		//the writer skips frames whose context is already done
+		return ctx.Err()
+	}
+}
+
+func (queue *SendQueue) enqueue(frame *outboundFrame) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	//control frames are few and small, they skip the full policy so a queue full of OPL frames never holds back a ping response
+	if queue.depth >= queue.capacity && frame.priority != enum.ControlPriority {
+		switch queue.policy {
+		case enum.FailWhenFull:
+			queue.stats.Rejected++
+			return ErrQueueFull
+		case enum.DropOldestWhenFull:
+			if !queue.dropOldest(frame.priority) {
+				queue.stats.Rejected++
+				return ErrQueueFull
+			}
+		default:
+			if err := queue.waitForSpace(frame.ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	if queue.closed {
+		return ErrQueueClosed
+	}
+
+	queue.lanes[frame.priority] = append(queue.lanes[frame.priority], frame)
+	queue.depth++
+	queue.stats.Enqueued++
+	queue.cond.Broadcast()
+	return nil
+}
+
+//waitForSpace blocks with the mutex held until there is room or the context is done
+func (queue *SendQueue) waitForSpace(ctx context.Context) error {
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			queue.mutex.Lock()
+			queue.cond.Broadcast()
+			queue.mutex.Unlock()
+		case <-finished:
+		}
+	}()
+
+	for queue.depth >= queue.capacity && !queue.closed {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		queue.cond.Wait()
+	}
+
+	return nil
+}
+
+//hold stops the writer taking frames other than control frames
+func (queue *SendQueue) hold() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.held = true
+}
+
+//release lets the writer drain every lane again
+func (queue *SendQueue) release() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.held = false
+	queue.cond.Broadcast()
+}
+
+func (queue *SendQueue) isHeld() bool {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	return queue.held
+}
+
+//Close fails the queued frames and stops the writer goroutine
+func (queue *SendQueue) Close() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.closed = true
+	for priority, lane := range queue.lanes {
+		for _, frame := range lane {
+			frame.finish(ErrQueueClosed)
+		}
+		queue.lanes[priority] = nil
+	}
+	queue.depth = 0
+	queue.cond.Broadcast()
+}
+
+func (queue *SendQueue) run() {
+	for {
+		frame, ok := queue.next()
+		if !ok {
+			return
+		}
+
+		if err := frame.ctx.Err(); err != nil {
+			frame.finish(err)
+			continue
+		}
+
+		frame.finish(queue.write(frame))
+	}
+}
+
+//next pops the oldest frame of the highest priority lane, waiting while there is nothing the writer may take
+func (queue *SendQueue) next() (*outboundFrame, bool) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	for !queue.ready() && !queue.closed {
+		queue.cond.Wait()
+	}
+
+	if queue.closed {
+		return nil, false
+	}
+
+	var frame *outboundFrame
+	for priority, lane := range queue.lanes {
+		if len(lane) > 0 {
+			frame = lane[0]
+			queue.lanes[priority] = lane[1:]
+			break
+		}
+	}
+	queue.depth--
+
+	wait := time.Since(frame.enqueued)
+	queue.stats.Sent++
+	queue.stats.TotalWait += wait
+	if wait > queue.stats.MaxWait {
+		queue.stats.MaxWait = wait
+	}
+
+	//wake senders blocked on a full queue
+	queue.cond.Broadcast()
+	return frame, true
+}
+
+//ready reports whether there is a frame for the writer, only the control lane counts while the queue is held
+func (queue *SendQueue) ready() bool {
+	if queue.held {
+		return len(queue.lanes[enum.ControlPriority]) > 0
+	}
+
+	return queue.depth > 0
+}
+
+//dropOldest evicts the oldest frame of the lowest priority lane that is not above the incoming priority
+//it reports false when the queue is full of more important frames
+func (queue *SendQueue) dropOldest(incoming enum.SendPriority) bool {
+	for priority := len(queue.lanes) - 1; priority >= int(incoming); priority-- {
+		lane := queue.lanes[priority]
+		if len(lane) == 0 {
+			continue
+		}
+
+		queue.lanes[priority] = lane[1:]
+		queue.depth--
+		queue.stats.Dropped++
+		lane[0].finish(ErrDroppedFromQueue)
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,289 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+)
+
+//stubWriter records what the queue writes, every write waits until the test releases the writer
+type stubWriter struct {
+	mutex   sync.Mutex
+	written []string
+	writing chan struct{}
+	gate    chan struct{}
+	once    sync.Once
+}
+
+func (writer *stubWriter) write(frame *outboundFrame) error {
+	writer.writing <- struct{}{}
+	<-writer.gate
+
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	writer.written = append(writer.written, string(frame.data))
+	return nil
+}
+
+func (writer *stubWriter) release() {
+	writer.once.Do(func() { close(writer.gate) })
+}
+
+func (writer *stubWriter) frames() []string {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return append([]string(nil), writer.written...)
+}
+
+//blockedQueue returns a queue whose writer is stuck on the frame "blocker", so everything sent after it stays queued
+func blockedQueue(t *testing.T, capacity int, policy enum.QueueFullPolicy) (*SendQueue, *stubWriter, chan error) {
+	t.Helper()
+	writer := &stubWriter{writing: make(chan struct{}, 64), gate: make(chan struct{})}
+	queue := newSendQueue(capacity, policy, writer.write)
+	t.Cleanup(func() {
+		writer.release()
+		queue.Close()
+	})
+
+	blocker := sendAsync(context.Background(), queue, enum.OPLPriority, "blocker")
+	select {
+	case <-writer.writing:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the writer never picked up the first frame")
+	}
+
+	return queue, writer, blocker
+}
+
+func sendAsync(ctx context.Context, queue *SendQueue, priority enum.SendPriority, data string) chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- queue.Send(ctx, priority, []byte(data))
+	}()
+	return result
+}
+
+//queueInOrder sends the frames one after the other, waiting for each to be queued before sending the next
+func queueInOrder(t *testing.T, queue *SendQueue, priority enum.SendPriority, frames ...string) map[string]chan error {
+	t.Helper()
+	results := map[string]chan error{}
+	for _, data := range frames {
+		depth := queue.Stats().Depth
+		results[data] = sendAsync(context.Background(), queue, priority, data)
+		waitForDepth(t, queue, depth+1)
+	}
+
+	return results
+}
+
+func waitForDepth(t *testing.T, queue *SendQueue, depth int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for queue.Stats().Depth != depth {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue depth stayed at %d, expected %d", queue.Stats().Depth, depth)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func expectResult(t *testing.T, name string, result chan error, expected error) {
+	t.Helper()
+	select {
+	case err := <-result:
+		if !errors.Is(err, expected) {
+			t.Fatalf("%s: expected %v, got %v", name, expected, err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("%s: send never returned", name)
+	}
+}
+
+func TestSendQueueFullPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy enum.QueueFullPolicy
+		//overflowWaits is true when the send into the full queue waits for the writer
+		overflowWaits bool
+		results       map[string]error
+		written       []string
+		stats         SendQueueStats
+	}{
+		{
+			name:          "block when full",
+			policy:        enum.BlockWhenFull,
+			overflowWaits: true,
+			results:       map[string]error{"a": nil, "b": nil, "c": nil},
+			written:       []string{"blocker", "a", "b", "c"},
+			stats:         SendQueueStats{Enqueued: 4, Sent: 4},
+		},
+		{
+			name:    "fail when full",
+			policy:  enum.FailWhenFull,
+			results: map[string]error{"a": nil, "b": nil, "c": ErrQueueFull},
+			written: []string{"blocker", "a", "b"},
+			stats:   SendQueueStats{Enqueued: 3, Sent: 3, Rejected: 1},
+		},
+		{
+			name:    "drop oldest when full",
+			policy:  enum.DropOldestWhenFull,
+			results: map[string]error{"a": ErrDroppedFromQueue, "b": nil, "c": nil},
+			written: []string{"blocker", "b", "c"},
+			stats:   SendQueueStats{Enqueued: 4, Sent: 3, Dropped: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			queue, writer, blocker := blockedQueue(t, 2, test.policy)
+			results := queueInOrder(t, queue, enum.OPLPriority, "a", "b")
+			results["c"] = sendAsync(context.Background(), queue, enum.OPLPriority, "c")
+
+			if test.overflowWaits {
+				select {
+				case err := <-results["c"]:
+					t.Fatalf("the send into the full queue returned %v without waiting", err)
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+
+			//the queue must still be full when the overflow is decided
+			deadline := time.Now().Add(2 * time.Second)
+			for stats := queue.Stats(); stats.Rejected+stats.Dropped != test.stats.Rejected+test.stats.Dropped; stats = queue.Stats() {
+				if time.Now().After(deadline) {
+					t.Fatalf("the full policy never applied, stats %+v", stats)
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			writer.release()
+			expectResult(t, "blocker", blocker, nil)
+			for _, data := range []string{"a", "b", "c"} {
+				expectResult(t, data, results[data], test.results[data])
+			}
+
+			if written := writer.frames(); !reflect.DeepEqual(written, test.written) {
+				t.Fatalf("expected %v written, got %v", test.written, written)
+			}
+
+			stats := queue.Stats()
+			if stats.Depth != 0 || stats.Capacity != 2 || stats.Enqueued != test.stats.Enqueued || stats.Sent != test.stats.Sent ||
+				stats.Dropped != test.stats.Dropped || stats.Rejected != test.stats.Rejected {
+				t.Fatalf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestSendQueueControlFramesBypassTheFullPolicy(t *testing.T) {
+	for _, policy := range []enum.QueueFullPolicy{enum.BlockWhenFull, enum.FailWhenFull, enum.DropOldestWhenFull} {
+		t.Run(policy.String(), func(t *testing.T) {
+			queue, writer, _ := blockedQueue(t, 1, policy)
+			results := queueInOrder(t, queue, enum.OPLPriority, "a")
+
+			//the control frame is queued past the capacity without waiting, failing or evicting
+			control := sendAsync(context.Background(), queue, enum.ControlPriority, "control")
+			waitForDepth(t, queue, 2)
+
+			writer.release()
+			expectResult(t, "control", control, nil)
+			expectResult(t, "a", results["a"], nil)
+
+			if written := writer.frames(); !reflect.DeepEqual(written, []string{"blocker", "control", "a"}) {
+				t.Fatalf("unexpected write order %v", written)
+			}
+		})
+	}
+}
+
+func TestSendQueueLaneOrder(t *testing.T) {
+	queue, writer, _ := blockedQueue(t, 10, enum.BlockWhenFull)
+	queueInOrder(t, queue, enum.BulkPriority, "bulk-1")
+	queueInOrder(t, queue, enum.OPLPriority, "opl-1")
+	queueInOrder(t, queue, enum.ControlPriority, "control-1")
+	queueInOrder(t, queue, enum.BulkPriority, "bulk-2")
+	queueInOrder(t, queue, enum.OPLPriority, "opl-2")
+	queueInOrder(t, queue, enum.ControlPriority, "control-2")
+
+	if laneDepths := queue.Stats().LaneDepths; !reflect.DeepEqual(laneDepths, []int{2, 2, 2}) {
+		t.Fatalf("unexpected lane depths %v", laneDepths)
+	}
+
+	writer.release()
+	waitForDepth(t, queue, 0)
+	expected := []string{"blocker", "control-1", "control-2", "opl-1", "opl-2", "bulk-1", "bulk-2"}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(writer.frames()) < len(expected) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if written := writer.frames(); !reflect.DeepEqual(written, expected) {
+		t.Fatalf("expected %v, got %v", expected, written)
+	}
+}
+
+func TestSendQueueHoldKeepsOnlyControlFramesMoving(t *testing.T) {
+	queue, writer, _ := blockedQueue(t, 10, enum.BlockWhenFull)
+	queue.hold()
+	results := queueInOrder(t, queue, enum.OPLPriority, "opl")
+	control := sendAsync(context.Background(), queue, enum.ControlPriority, "control")
+
+	writer.release()
+	expectResult(t, "control", control, nil)
+	select {
+	case err := <-results["opl"]:
+		t.Fatalf("a held OPL frame was sent: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	queue.release()
+	expectResult(t, "opl", results["opl"], nil)
+	if written := writer.frames(); !reflect.DeepEqual(written, []string{"blocker", "control", "opl"}) {
+		t.Fatalf("unexpected write order %v", written)
+	}
+}
+
+func TestSendQueueContextCancelledWhileQueued(t *testing.T) {
+	queue, writer, _ := blockedQueue(t, 10, enum.BlockWhenFull)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := sendAsync(ctx, queue, enum.OPLPriority, "cancelled")
+	waitForDepth(t, queue, 1)
+	results := queueInOrder(t, queue, enum.OPLPriority, "kept")
+
+	//the sender gets its answer at once, the writer skips the frame later
+	cancel()
+	expectResult(t, "cancelled", cancelled, context.Canceled)
+
+	writer.release()
+	expectResult(t, "kept", results["kept"], nil)
+	if written := writer.frames(); !reflect.DeepEqual(written, []string{"blocker", "kept"}) {
+		t.Fatalf("unexpected frames written %v", written)
+	}
+}
+
+func TestSendQueueClose(t *testing.T) {
+	queue, writer, blocker := blockedQueue(t, 10, enum.BlockWhenFull)
+	results := queueInOrder(t, queue, enum.OPLPriority, "a", "b")
+
+	queue.Close()
+	expectResult(t, "a", results["a"], ErrQueueClosed)
+	expectResult(t, "b", results["b"], ErrQueueClosed)
+	expectResult(t, "after close", sendAsync(context.Background(), queue, enum.ControlPriority, "late"), ErrQueueClosed)
+
+	if stats := queue.Stats(); stats.Depth != 0 {
+		t.Fatalf("closed queue still holds %d frames", stats.Depth)
+	}
+
+	//the frame the writer already held is still written
+	writer.release()
+	expectResult(t, "blocker", blocker, nil)
+	if written := writer.frames(); !reflect.DeepEqual(written, []string{"blocker"}) {
+		t.Fatalf("unexpected frames written %v", written)
+	}
+}
@@ -0,0 +1,110 @@
+package mtsclient
+
+import (
+	"sync"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+)
+
+//Session is the login state of one client, every TCPConnect owns its own so clients in one process never share a login
+//reads are safe from any goroutine, the getters hand out copies
+type Session struct {
+	mutex             sync.RWMutex
+	appID             enum.AppID
+	appKey            []byte
+	nodeID            int
+	clientCertificate []byte
+	token             *helper.JWTClaims
+	mtu               MTU
+}
+
+//NewSession is the ctor for a session that logs in with the given identity
+func NewSession(identity ClientIdentity) *Session {
+	return &Session{
+		appID:  identity.AppID,
+		appKey: append([]byte(nil), identity.AppKey...),
+		nodeID: identity.NodeID,
+	}
+}
+
+//AppID is the app the client logs in as
+func (session *Session) AppID() enum.AppID {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	return session.appID
+}
+
+//AppKey is the key sent with every login
+func (session *Session) AppKey() []byte {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	return append([]byte(nil), session.appKey...)
+}
+
+//NodeID is the SrcID of the requests the client sends
+func (session *Session) NodeID() int {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	return session.nodeID
+}
+
+//ClientCertificate is the certificate issued by the last password login, nil before it
+func (session *Session) ClientCertificate() []byte {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	return append([]byte(nil), session.clientCertificate...)
+}
+
+//SetClientCertificate replaces the certificate used by the certificate login, nil forgets it
+func (session *Session) SetClientCertificate(certificate []byte) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	session.clientCertificate = append([]byte(nil), certificate...)
+	if len(certificate) == 0 {
+		session.clientCertificate = nil
+	}
+}
+
+//HasClientCertificate reports whether a certificate login is possible
+func (session *Session) HasClientCertificate() bool {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	return len(session.clientCertificate) > 0
+}
+
+//JWT is the token outbound messages carry, nil before the first login
+func (session *Session) JWT() *helper.JWTClaims {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	return session.token
+}
+
+func (session *Session) setJWT(token *helper.JWTClaims) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	session.token = token
+}
+
+//MTU is the set of limits from the last login response
+func (session *Session) MTU() MTU {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+
+	return session.mtu
+}
+
+func (session *Session) setMTU(mtu MTU) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	session.mtu = mtu
+}
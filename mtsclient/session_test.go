@@ -0,0 +1,350 @@
+package mtsclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//loginServer is an in-process TLS stand-in for the MTS server that answers logins and the routes given a handler
+//a password login issues a certificate and a token for the username, a certificate login issues a new token for its owner
+type loginServer struct {
+	listener net.Listener
+	mutex    sync.Mutex
+	//owners maps every issued certificate to its username
+	owners map[string]string
+	//appKeys records the app key every login of a username came with
+	appKeys map[string][][]byte
+	issued  int
+	//mtuMts and compression are announced in every login response
+	mtuMts      int
+	compression string
+	handlers    map[enum.MTSRequest]func(request model.MTSMessage) model.MTSMessage
+	//largestFrame is the longest frame received after a login, header included
+	largestFrame int
+	//framesBeforeLogin counts the frames that reached a connection ahead of its login
+	framesBeforeLogin int
+}
+
+func newLoginServer(t *testing.T) *loginServer {
+	t.Helper()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{selfSignedCertificate(t)}})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	server := &loginServer{
+		listener: listener,
+		owners:   map[string]string{},
+		appKeys:  map[string][][]byte{},
+		handlers: map[enum.MTSRequest]func(request model.MTSMessage) model.MTSMessage{},
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go server.accept()
+	return server
+}
+
+func (server *loginServer) accept() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go server.serve(conn)
+	}
+}
+
+func (server *loginServer) serve(conn net.Conn) {
+	defer conn.Close()
+	frameReader := helper.NewFrameReader(conn)
+	loggedIn := false
+	for {
+		frame, err := frameReader.ReadFrame()
+		if err != nil {
+			return
+		}
+
+		request := model.MTSMessage{}
+		if err = json.Unmarshal(frame, &request); err != nil {
+			continue
+		}
+
+		if request.Route != enum.Login && !loggedIn {
+			server.frameBeforeLogin()
+		}
+
+		if request.Route != enum.Login {
+			if handler := server.handler(request.Route, len(frame)+helper.Offset); handler != nil {
+				if err = writeServerMessage(conn, handler(request)); err != nil {
+					return
+				}
+			}
+			continue
+		}
+
+		login := model.MtsLogin{}
+		if err = json.Unmarshal(request.Data, &login); err != nil {
+			return
+		}
+		loggedIn = true
+
+		response, token := server.login(login)
+		data, _ := json.Marshal(response)
+		err = writeServerMessage(conn, model.MTSMessage{
+			Version: helper.ProtocolVersion1,
+			Route:   enum.LoginResponse,
+			RPCID:   request.RPCID,
+			Reply:   true,
+			JWT:     &token,
+			Data:    data,
+		})
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeServerMessage(conn net.Conn, mtsMessage model.MTSMessage) error {
+	msg, err := json.Marshal(mtsMessage)
+	if err != nil {
+		return err
+	}
+
+	frame, err := helper.PrepareFrame(helper.DefaultFramer, msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.Write(frame)
+	return err
+}
+
+//handle answers every request on the route with the message the handler returns
+func (server *loginServer) handle(route enum.MTSRequest, handler func(request model.MTSMessage) model.MTSMessage) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.handlers[route] = handler
+}
+
+func (server *loginServer) handler(route enum.MTSRequest, frameLength int) func(request model.MTSMessage) model.MTSMessage {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	if frameLength > server.largestFrame {
+		server.largestFrame = frameLength
+	}
+
+	return server.handlers[route]
+}
+
+func (server *loginServer) announceMTU(mtuMts int) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.mtuMts = mtuMts
+}
+
+func (server *loginServer) pickCompression(compression string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.compression = compression
+}
+
+func (server *loginServer) largestFrameLength() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.largestFrame
+}
+
+func (server *loginServer) frameBeforeLogin() {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	server.framesBeforeLogin++
+}
+
+func (server *loginServer) framesAheadOfLogin() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.framesBeforeLogin
+}
+
+func (server *loginServer) login(login model.MtsLogin) (model.MtsLoginResponse, string) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	response := model.MtsLoginResponse{Version: helper.ProtocolVersion1, MtuMts: server.mtuMts, Compression: server.compression}
+	userName := server.owners[string(login.ClientCertificate)]
+	if login.Username != nil {
+		userName = *login.Username
+		server.issued++
+		response.ClientCertificate = []byte(fmt.Sprintf("certificate-%d-%s", server.issued, userName))
+		server.owners[string(response.ClientCertificate)] = userName
+	}
+
+	server.appKeys[userName] = append(server.appKeys[userName], append([]byte(nil), login.AppKey...))
+	return response, unsignedToken(userName)
+}
+
+func (server *loginServer) owner(certificate []byte) string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.owners[string(certificate)]
+}
+
+func (server *loginServer) loginAppKeys(userName string) [][]byte {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	return server.appKeys[userName]
+}
+
+func (server *loginServer) client(userName string, identity ClientIdentity) *TCPConnect {
+	connect := NewTCPConnect("127.0.0.1", server.listener.Addr().(*net.TCPAddr).Port, 5000)
+	connect.WithTLS(&helper.TLSPolicy{InsecureSkipVerify: true})
+	connect.WithIdentity(identity)
+	connect.Credentials = StaticCredentials{UserName: userName, Password: userName + "-password"}
+	return connect
+}
+
+//unsignedToken is a JWT whose claims name the user, the client only reads the claims without a VerificationKey
+func unsignedToken(userName string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	claims := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":%q,"iat":%d,"exp":%d}`, userName, time.Now().Unix(), time.Now().Add(time.Hour).Unix())))
+	return header + "." + claims + ".signature"
+}
+
+func selfSignedCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestSessionsStayIsolated(t *testing.T) {
+	server := newLoginServer(t)
+	alice := server.client("alice", RMSIntegratorIdentity())
+	bob := server.client("bob", BTPPIdentity([]byte("bob-app-key")))
+	defer alice.Close()
+	defer bob.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	//log both clients in at the same time so any shared state would be overwritten mid login
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, connect := range []*TCPConnect{alice, bob} {
+		wg.Add(1)
+		go func(i int, connect *TCPConnect) {
+			defer wg.Done()
+			errs[i] = connect.ConnectAndLoginContext(ctx)
+		}(i, connect)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("login %d: %v", i, err)
+		}
+	}
+
+	assertSession(t, server, alice, "alice", RMSIntegratorIdentity().AppKey)
+	assertSession(t, server, bob, "bob", []byte("bob-app-key"))
+
+	if alice.Session == bob.Session || alice.Tokens == bob.Tokens {
+		t.Fatal("clients share a session")
+	}
+
+	//refreshing one client's token must not touch the other client
+	bobToken := bob.Tokens.Current()
+	if err := alice.Tokens.Refresh(ctx); err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+	if bob.Tokens.Current() != bobToken {
+		t.Fatal("refreshing alice replaced bob's token")
+	}
+	assertSession(t, server, alice, "alice", RMSIntegratorIdentity().AppKey)
+
+	alice.Session.SetClientCertificate(nil)
+	if !bob.Session.HasClientCertificate() {
+		t.Fatal("clearing alice's certificate cleared bob's")
+	}
+}
+
+func assertSession(t *testing.T, server *loginServer, connect *TCPConnect, userName string, appKey []byte) {
+	t.Helper()
+	session := connect.Session
+
+	if owner := server.owner(session.ClientCertificate()); owner != userName {
+		t.Fatalf("%s holds the certificate of %q", userName, owner)
+	}
+
+	if token := connect.Tokens.Current(); token == nil || !bytes.Contains(claimsOf(t, token.Raw), []byte(fmt.Sprintf(`"sub":%q`, userName))) {
+		t.Fatalf("%s holds the wrong token", userName)
+	}
+
+	if !bytes.Equal(session.AppKey(), appKey) {
+		t.Fatalf("%s holds the app key %x", userName, session.AppKey())
+	}
+
+	for _, loginAppKey := range server.loginAppKeys(userName) {
+		if !bytes.Equal(loginAppKey, appKey) {
+			t.Fatalf("%s logged in with the app key %x", userName, loginAppKey)
+		}
+	}
+}
+
+func claimsOf(t *testing.T, token string) []byte {
+	t.Helper()
+	parts := bytes.Split([]byte(token), []byte("."))
+	if len(parts) != 3 {
+		t.Fatalf("token %q is not a JWT", token)
+	}
+
+	claims, err := base64.RawURLEncoding.DecodeString(string(parts[1]))
+	if err != nil {
+		t.Fatalf("token claims: %v", err)
+	}
+
+	return claims
+}
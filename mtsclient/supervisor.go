@@ -0,0 +1,182 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+)
+
+//ErrReconnectAttemptsExhausted is returned once the backoff policy runs out of attempts
+var ErrReconnectAttemptsExhausted = errors.New("reconnect attempts exhausted")
+
+//BackoffPolicy controls the delay between reconnect attempts
+type BackoffPolicy struct {
+	//InitialInterval is the delay before the first reconnect attempt
+	InitialInterval time.Duration
+	//MaxInterval caps the delay between attempts
+	MaxInterval time.Duration
+	//Multiplier grows the delay after every failed attempt
+	Multiplier float64
+	//Jitter randomises each delay by up to this fraction in either direction
+	Jitter float64
+	//MaxAttempts is the number of attempts per outage, 0 retries forever
+	MaxAttempts int
+}
+
+//DefaultBackoffPolicy starts at 500ms and doubles up to 30s with 20% jitter
+func DefaultBackoffPolicy() BackoffPolicy {
+	return BackoffPolicy{
+		InitialInterval: 500 * time.Millisecond,
+		MaxInterval:     30 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.2,
+		MaxAttempts:     10,
+	}
+}
+
+//Delay returns the jittered delay before the given attempt, starting at 1
+func (policy BackoffPolicy) Delay(attempt int) time.Duration {
+	interval := float64(policy.InitialInterval) * math.Pow(policy.Multiplier, float64(attempt-1))
+	if interval > float64(policy.MaxInterval) {
+		interval = float64(policy.MaxInterval)
+	}
+
+	if policy.Jitter > 0 {
+		interval = interval * (1 - policy.Jitter + 2*policy.Jitter*rand.Float64())
+	}
+
+	return time.Duration(interval)
+}
+
+//Supervisor keeps the certificate session alive across transient connection failures
+type Supervisor struct {
+	Backoff BackoffPolicy
+	//States publishes every state transition, transitions are dropped when nobody reads them
+	States  chan enum.ConnectionState
+	connect *TCPConnect
+}
+
+//NewSupervisor is the ctor that watches the client's ErrorChan
+func NewSupervisor(connect *TCPConnect, backoff BackoffPolicy) *Supervisor {
+	return &Supervisor{
+		Backoff: backoff,
+		States:  make(chan enum.ConnectionState, 16),
+		connect: connect,
+	}
+}
+
+//Run logs in and then redials with the client certificate on every transient failure
+//it returns the permanent failure, or the context error once the context is done
+func (supervisor *Supervisor) Run(ctx context.Context) error {
+	supervisor.publish(enum.Connecting)
+	if err := supervisor.connect.ConnectAndLoginContext(ctx); err != nil {
+		if !IsTransient(err) {
+			return supervisor.fail(err)
+		}
+
+		if err = supervisor.reconnect(ctx); err != nil {
+			return supervisor.fail(err)
+		}
+	}
+
+	supervisor.publish(enum.Connected)
+	for {
+		select {
+		case <-ctx.Done():
+			supervisor.connect.closeConn()
+			return ctx.Err()
+		case err := <-supervisor.connect.ErrorChan:
+			fmt.Println("connection failure: ", err)
+			if !IsTransient(err) {
+				return supervisor.fail(err)
+			}
+
+			if err = supervisor.reconnect(ctx); err != nil {
+				return supervisor.fail(err)
+			}
+			supervisor.publish(enum.Connected)
+		}
+	}
+}
+
+func (supervisor *Supervisor) reconnect(ctx context.Context) error {
+	supervisor.publish(enum.Reconnecting)
+	supervisor.connect.closeConn()
+
+	for attempt := 1; supervisor.Backoff.MaxAttempts == 0 || attempt <= supervisor.Backoff.MaxAttempts; attempt++ {
+		delay := supervisor.Backoff.Delay(attempt)
+		fmt.Printf("reconnect attempt %d in %s\n", attempt, delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		attemptCtx, cancel := supervisor.connect.withDefaultTimeout(ctx)
+		err := supervisor.relogin(attemptCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !IsTransient(err) {
+			return err
+		}
+		fmt.Println("reconnect failed: ", err)
+	}
+
+	return ErrReconnectAttemptsExhausted
+}
+
+//relogin reuses the issued client certificate, falling back to the password login when none was issued yet
+func (supervisor *Supervisor) relogin(ctx context.Context) error {
+	if !supervisor.connect.Session.HasClientCertificate() {
+		return supervisor.connect.connectAndLogin(ctx)
+	}
+
+	return supervisor.connect.reconnectWithCertificate(ctx)
+}
+
+func (supervisor *Supervisor) fail(err error) error {
+	supervisor.publish(enum.Failed)
+	return err
+}
+
+func (supervisor *Supervisor) publish(state enum.ConnectionState) {
+	select {
+	case supervisor.States <- state:
+	default:
+	}
+}
+
+//IsTransient reports whether redialing may recover from the error
+func IsTransient(err error) bool {
+	var verificationError *helper.TLSVerificationError
+	var mtsError *MtsError
+	if errors.As(err, &verificationError) || errors.As(err, &mtsError) {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, helper.ErrFrameTooLarge) || errors.Is(err, helper.ErrInvalidFrameLength) {
+		return true
+	}
+
+	var netError net.Error
+	return errors.As(err, &netError)
+}
@@ -2,17 +2,19 @@ package mtsclient
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/niroopreddym/custom-tcpprotocol-go/codec"
 	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
 	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
 	"github.com/niroopreddym/custom-tcpprotocol-go/model"
@@ -31,15 +33,6 @@ const (
 	WriteBufferSize = 1 << 12
 )
 
-var (
-	//ClientCertificate has the client cert
-	ClientCertificate []byte
-	//JWT has the JWT data
-	JWT []byte
-	//KAppRMS rms key
-	KAppRMS = []byte{79, 157, 102, 210, 83, 34, 156, 117, 223, 190, 187, 27, 28, 63, 94, 214, 4, 98, 123, 98, 65, 20, 143, 60, 50, 62, 162, 115, 7, 46, 119, 8}
-)
-
 //TCPConnect is the struct that implements the socket communication functionality
 type TCPConnect struct {
 	MTSClient        model.MTSClient
@@ -50,80 +43,390 @@ type TCPConnect struct {
 	ServerBootDone   chan bool
 	Wg               sync.WaitGroup
 	IsAuthenticated  chan bool
-	UserName         *string
-	Password         *string
+	//Credentials supplies the username and password for every password login
+	Credentials CredentialProvider
+	//CertificateStore persists the issued client certificate, nil keeps it in memory only
+	CertificateStore CertificateStore
 	ErrorChan        chan error
+	Codec            codec.Codec
+	//MaxInboundFrameLength is the largest frame accepted from the server
+	MaxInboundFrameLength int
+	//Framer is the length prefix shared by the reader and the writer
+	Framer helper.Framer
+	//OfferedCompressions are the frame compressions advertised at login, empty disables compression
+	OfferedCompressions []string
+	//Compressor is the frame compression the server picked for the current connection, guarded by connMutex
+	Compressor helper.Compressor
+	//TLSPolicy verifies the server and carries the mTLS client certificate
+	TLSPolicy *helper.TLSPolicy
+	//RPCIDs numbers the outgoing requests of this client
+	RPCIDs helper.RPCIDGenerator
+	//Session holds the certificate, token and app credentials of this client
+	Session *Session
+	//KeyCache holds the communication keys for encrypting lock commands
+	KeyCache *CommunicationKeyCache
+	//Tokens holds the session JWT and refreshes it, run Tokens.Run to refresh ahead of expiry
+	Tokens *TokenManager
+	//Router dispatches the messages the server pushes, register handlers for additional routes on it
+	Router   *Router
+	outbound []SendMiddleware
+	pending  *pendingCalls
+	//ProtocolVersions is the range of MTSMessage versions advertised at login
+	ProtocolVersions helper.VersionRange
+	//VersionCodecs overrides Codec for the messages of a negotiated version
+	VersionCodecs map[byte]codec.Codec
+	//protocolVersion is the version the server picked at the last login, 0 before the login response, guarded by connMutex
+	protocolVersion byte
+	//connErr is the dial or transport error that ended the last login attempt
+	connErr       error
+	awaitingLogin bool
+	//closer closes the current connection and tells its reader whether the close was a failure
+	closer *connCloser
+	//connMutex guards Conn, closer, MTSClient.Connected, protocolVersion and Compressor, which the dialer, the reader and the senders share
+	connMutex sync.RWMutex
+	//sendQueue serialises every outbound frame through one writer goroutine
+	sendQueue *SendQueue
+	//routePriorities maps each route to its outbound lane, see SetRoutePriority
+	routePriorities map[enum.MTSRequest]enum.SendPriority
+	routeMutex      sync.RWMutex
+	//writer is reused across writes and reset whenever the connection is replaced
+	writer      *bufio.Writer
+	writerConn  net.Conn
+	writerMutex sync.Mutex
 }
 
 //NewTCPConnect is the ctor that instantiates the struct
 func NewTCPConnect(hostname string, port int, defaultTimeOutMs int) *TCPConnect {
-	return &TCPConnect{
+	connect := &TCPConnect{
 		MTSClient: model.MTSClient{
 			Connected: false,
 		},
-		Hostname:         hostname,
-		Port:             port,
-		DefaultTimeOutMs: defaultTimeOutMs,
-		Conn:             &tls.Conn{},
-		ServerBootDone:   make(chan bool),
-		Wg:               sync.WaitGroup{},
-		IsAuthenticated:  make(chan bool),
-		ErrorChan:        make(chan error),
+		Hostname:              hostname,
+		Port:                  port,
+		DefaultTimeOutMs:      defaultTimeOutMs,
+		Conn:                  &tls.Conn{},
+		ServerBootDone:        make(chan bool),
+		Wg:                    sync.WaitGroup{},
+		IsAuthenticated:       make(chan bool),
+		ErrorChan:             make(chan error),
+		Codec:                 codec.JSON,
+		MaxInboundFrameLength: helper.MaxMessageLength,
+		Framer:                helper.DefaultFramer,
+		OfferedCompressions:   helper.SupportedCompressions(),
+		pending:               newPendingCalls(),
+		routePriorities:       DefaultRoutePriorities(),
+		ProtocolVersions:      helper.DefaultVersionRange,
+		KeyCache:              NewCommunicationKeyCache(),
 	}
+	connect.Session = NewSession(RMSIntegratorIdentity())
+	connect.Tokens = newTokenManager(connect)
+	connect.Router = connect.defaultRouter()
+	connect.UseOutbound(RecoverySend(), InjectJWT(connect.currentJWT))
+	connect.sendQueue = newSendQueue(DefaultSendQueueCapacity, enum.BlockWhenFull, connect.writeFrame)
+	//only the login goes out before the first login completes
+	connect.sendQueue.hold()
+
+	return connect
 }
 
-//WithTLS connects with TLS
-func (connect *TCPConnect) WithTLS(certificate []byte) {
+//WithTLS connects with TLS, a nil policy verifies the server against the system roots
+func (connect *TCPConnect) WithTLS(policy *helper.TLSPolicy) {
+	if policy == nil {
+		policy = &helper.TLSPolicy{}
+	}
+
 	connect.MTSClient.UseTLS = true
-	connect.MTSClient.ClientCertificate = certificate
+	connect.TLSPolicy = policy
+}
+
+//tlsConfig builds the handshake config, presenting the login issued certificate when no explicit one is configured
+func (connect *TCPConnect) tlsConfig() (*tls.Config, error) {
+	policy := connect.TLSPolicy
+	if policy == nil {
+		policy = &helper.TLSPolicy{}
+	}
+
+	if certificate := connect.Session.ClientCertificate(); len(policy.ClientCertificate) == 0 && len(certificate) > 0 {
+		issuedPolicy := *policy
+		issuedPolicy.ClientCertificate = certificate
+		if tlsConfig, err := issuedPolicy.TLSConfig(connect.Hostname); err == nil {
+			return tlsConfig, nil
+		}
+
+		//the issued certificate still authenticates through the login payload
+		fmt.Println("issued client certificate is not a PEM key pair, skipping mTLS")
+	}
+
+	return policy.TLSConfig(connect.Hostname)
+}
+
+//WithProxy tunnels every connection through an HTTP CONNECT or SOCKS5 proxy, user may be empty
+func (connect *TCPConnect) WithProxy(proxyType enum.ProxyType, hostname string, port int, user string, password string) {
+	connect.MTSClient.ProxyType = proxyType
+	connect.MTSClient.ProxyHostname = hostname
+	connect.MTSClient.ProxyPort = port
+	connect.MTSClient.ProxyUser = user
+	connect.MTSClient.ProxyPassword = password
+	connect.MTSClient.ProxyTransactComplete = false
+}
+
+//WithCodec selects the encoding used for the MTSMessage envelope and its payloads
+func (connect *TCPConnect) WithCodec(messageCodec codec.Codec) {
+	connect.Codec = messageCodec
+}
+
+//WithSendQueue replaces the outbound queue, frames still waiting in the old one fail with ErrQueueClosed
+func (connect *TCPConnect) WithSendQueue(capacity int, policy enum.QueueFullPolicy) {
+	if capacity <= 0 {
+		capacity = DefaultSendQueueCapacity
+	}
+
+	previous := connect.sendQueue
+	previous.Close()
+	connect.sendQueue = newSendQueue(capacity, policy, connect.writeFrame)
+	if previous.isHeld() {
+		connect.sendQueue.hold()
+	}
+}
+
+//SendQueueStats returns the depth and wait times of the outbound queue
+func (connect *TCPConnect) SendQueueStats() SendQueueStats {
+	return connect.sendQueue.Stats()
+}
+
+//Close stops the writer goroutine and closes the connection
+func (connect *TCPConnect) Close() {
+	connect.sendQueue.Close()
+	connect.closeConn()
+}
+
+//WithFramer selects the length prefix used on both directions of the connection
+func (connect *TCPConnect) WithFramer(framer helper.Framer) {
+	connect.Framer = framer
 }
 
 //TCPServer returns the TCP server connection
 func (connect *TCPConnect) TCPServer(ClientCertificate []byte, authenticationCall func()) {
+	connect.dialAndAuthenticate(context.Background(), connect.IsAuthenticated, func(ctx context.Context, isAuthenticated chan bool) {
+		authenticationCall()
+	})
+}
+
+//dialAndAuthenticate dials within the context and runs the login on the new connection
+func (connect *TCPConnect) dialAndAuthenticate(ctx context.Context, isAuthenticated chan bool, authenticationCall func(ctx context.Context, isAuthenticated chan bool)) {
 	connectionString := strings.Join([]string{connect.Hostname, strconv.Itoa(connect.Port)}, ":")
-	conn, err := helper.GetConnection(connectionString)
+	var conn net.Conn
+	tlsConfig, err := connect.tlsConfig()
+	if err == nil {
+		connect.connMutex.RLock()
+		proxyDialer := helper.NewProxyDialer(connect.MTSClient)
+		connect.connMutex.RUnlock()
+		conn, err = helper.GetConnectionContext(ctx, connectionString, tlsConfig, proxyDialer)
+	}
+
+	if err == nil && ctx.Err() != nil {
+		//the caller stopped waiting while the handshake completed
+		conn.Close()
+		err = ctx.Err()
+	}
+
 	if err != nil {
 		fmt.Println("error while instantiating the connection", err)
-		os.Exit(1)
+		connect.connErr = err
+		isAuthenticated <- false
+		return
 	}
 
+	//frames queued for the previous connection wait until the new one is logged in, so none reach the wire before the login
+	connect.sendQueue.hold()
+	connect.connErr = nil
+	connect.connMutex.Lock()
 	connect.MTSClient.Connected = true
+	connect.MTSClient.ProxyTransactComplete = connect.MTSClient.ProxyType != enum.NoProxy
 	connect.Conn = conn
-
-	authenticationCall()
+	connect.closer = &connCloser{conn: conn}
+	//compression and the message version are negotiated again by every login
+	connect.protocolVersion = 0
+	connect.Compressor = nil
+	connect.connMutex.Unlock()
+	connect.awaitingLogin = true
+
+	authenticationCall(ctx, isAuthenticated)
 }
 
 //ConnectAndLogin connects and login the user
 func (connect *TCPConnect) ConnectAndLogin() {
-	go connect.TCPServer(nil, connect.loginWithUsernameAndPassword)
+	if err := connect.ConnectAndLoginContext(context.Background()); err != nil {
+		fmt.Println(err)
+		go func() { connect.ErrorChan <- err }()
+		return
+	}
+
+	fmt.Println("successfully booted up the server with the client certificate")
+	go func() { connect.ServerBootDone <- true }()
+}
+
+//ConnectAndLoginContext connects and login the user, DefaultTimeOutMs applies when the context has no deadline
+func (connect *TCPConnect) ConnectAndLoginContext(ctx context.Context) error {
+	ctx, cancel := connect.withDefaultTimeout(ctx)
+	defer cancel()
 
-	if <-connect.IsAuthenticated {
-		connect.Conn.Close()
-	} else {
-		fmt.Println("UnAuthorized login creds")
-		go func() { connect.ErrorChan <- fmt.Errorf("UnAuthorized login creds") }()
+	return connect.connectAndLogin(ctx)
+}
+
+//connectAndLogin logs in with the stored client certificate, or exchanges the username and password for one and logs in with it
+func (connect *TCPConnect) connectAndLogin(ctx context.Context) error {
+	if done, err := connect.loginWithStoredCertificate(ctx); done {
+		return err
 	}
 
-	connect.WithTLS(ClientCertificate)
-	go connect.TCPServer(nil, connect.loginWithCertificate)
+	if err := connect.authenticate(ctx, connect.loginWithUsernameAndPassword); err != nil {
+		return err
+	}
+
+	connect.closeConn()
+	connect.saveCertificate(ctx, connect.Session.ClientCertificate())
+	return connect.reconnectWithCertificate(ctx)
+}
 
-	if <-connect.IsAuthenticated {
-		fmt.Println("successfully booted up the server with the client certificate")
-		go func() { connect.ServerBootDone <- true }()
+//reconnectWithCertificate dials a fresh connection and logs in with the issued client certificate
+func (connect *TCPConnect) reconnectWithCertificate(ctx context.Context) error {
+	return connect.authenticate(ctx, connect.loginWithCertificate)
+}
+
+//authenticate waits for one dial and login round trip, closing the half open connection when the context ends first
+func (connect *TCPConnect) authenticate(ctx context.Context, authenticationCall func(ctx context.Context, isAuthenticated chan bool)) error {
+	//every attempt gets its own result channel so an abandoned attempt can never answer the next one
+	isAuthenticated := make(chan bool, 1)
+	connect.IsAuthenticated = isAuthenticated
+	go connect.dialAndAuthenticate(ctx, isAuthenticated, authenticationCall)
+
+	select {
+	case ok := <-isAuthenticated:
+		if !ok {
+			return connect.loginError()
+		}
+		return nil
+	case <-ctx.Done():
+		connect.closeConn()
+		return ctx.Err()
 	}
 }
 
-func (connect *TCPConnect) loginWithCertificate() {
+//closeConn closes the current connection on purpose, its reader exits without reporting on ErrorChan
+func (connect *TCPConnect) closeConn() {
+	_, closer := connect.connection()
+	connect.shutdownConn(closer, nil)
+}
+
+//dropConn closes the connection after a failure, its reader reports the failure on ErrorChan so the supervisor reconnects
+func (connect *TCPConnect) dropConn(closer *connCloser, failure error) {
+	connect.shutdownConn(closer, failure)
+}
+
+//shutdownConn closes the connection of the closer, the placeholder set by the ctor has nothing to close
+func (connect *TCPConnect) shutdownConn(closer *connCloser, failure error) {
+	connect.connMutex.Lock()
+	if closer != connect.closer {
+		connect.connMutex.Unlock()
+		//the connection was already replaced by a newer one
+		closer.close(failure)
+		return
+	}
+
+	if !connect.MTSClient.Connected {
+		connect.connMutex.Unlock()
+		return
+	}
+
+	connect.MTSClient.Connected = false
+	conn := connect.Conn
+	connect.connMutex.Unlock()
+
+	//the frames that follow wait for the next login
+	connect.sendQueue.hold()
+	if closer == nil {
+		conn.Close()
+		return
+	}
+
+	closer.close(failure)
+}
+
+//connection returns the current connection and its closer
+func (connect *TCPConnect) connection() (net.Conn, *connCloser) {
+	connect.connMutex.RLock()
+	defer connect.connMutex.RUnlock()
+
+	return connect.Conn, connect.closer
+}
+
+//connCloser closes one connection once and remembers why
+type connCloser struct {
+	conn   net.Conn
+	mutex  sync.Mutex
+	closed bool
+	//failure is the error that made the client drop the connection, nil when it was closed on purpose
+	failure error
+}
+
+func (closer *connCloser) close(failure error) {
+	if closer == nil {
+		return
+	}
+
+	closer.mutex.Lock()
+	if !closer.closed {
+		closer.closed = true
+		closer.failure = failure
+	}
+	closer.mutex.Unlock()
+
+	closer.conn.Close()
+}
+
+//state reports whether the client closed the connection and the failure that made it do so
+func (closer *connCloser) state() (bool, error) {
+	if closer == nil {
+		return false, nil
+	}
+
+	closer.mutex.Lock()
+	defer closer.mutex.Unlock()
+
+	return closer.closed, closer.failure
+}
+
+func (connect *TCPConnect) withDefaultTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || connect.DefaultTimeOutMs <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Duration(connect.DefaultTimeOutMs)*time.Millisecond)
+}
+
+func (connect *TCPConnect) loginError() error {
+	if connect.connErr != nil {
+		return connect.connErr
+	}
+
+	return &MtsError{ID: enum.InvalidLogin, Message: "UnAuthorized login creds", Route: enum.Login}
+}
+
+func (connect *TCPConnect) loginWithCertificate(ctx context.Context, isAuthenticated chan bool) {
 
 	mtsLogin := model.MtsLogin{
-		AppID:             enum.RMSServer,
-		AppKey:            KAppRMS,
-		ClientCertificate: ClientCertificate,
+		AppID:             connect.Session.AppID(),
+		AppKey:            connect.Session.AppKey(),
+		ClientCertificate: connect.Session.ClientCertificate(),
 		Username:          nil,
 		Password:          nil,
+		Compression:       connect.OfferedCompressions,
+		MinVersion:        connect.ProtocolVersions.Min,
+		MaxVersion:        connect.ProtocolVersions.Max,
 	}
 
-	mtsLoginByteData, err := json.Marshal(mtsLogin)
+	mtsLoginByteData, err := connect.codec().Marshal(mtsLogin)
 	if err != nil {
 		fmt.Println("error in marshalling the mtsLogin Data: ", err)
 		go func() { connect.ErrorChan <- err }()
@@ -131,27 +434,46 @@ func (connect *TCPConnect) loginWithCertificate() {
 	}
 
 	mtsLoginMessage := helper.CreateRequest(
+		&connect.RPCIDs,
 		enum.Login,
 		nil,
-		MTSRMSServer,
+		connect.Session.NodeID(),
 		MTSServer,
 		false,
 		nil,
 		mtsLoginByteData,
 	)
 
-	connect.Login(mtsLoginMessage, connect.IsAuthenticated)
+	connect.LoginContext(ctx, mtsLoginMessage, isAuthenticated)
 }
 
-func (connect *TCPConnect) loginWithUsernameAndPassword() {
-	mtsLogin := model.MtsLogin{
-		AppID:    enum.RMSServer,
-		AppKey:   KAppRMS,
-		Username: connect.UserName,
-		Password: connect.Password,
+func (connect *TCPConnect) loginWithUsernameAndPassword(ctx context.Context, isAuthenticated chan bool) {
+	if connect.Credentials == nil {
+		connect.closeConn()
+		connect.failLogin(ErrMissingCredentials, isAuthenticated)
+		return
+	}
+
+	credentials, err := connect.Credentials.Credentials(ctx)
+	if err != nil {
+		fmt.Println("error getting the login credentials: ", err)
+		connect.closeConn()
+		connect.failLogin(err, isAuthenticated)
+		return
+	}
+
+	mtsLogin := passwordLogin{
+		AppID:       connect.Session.AppID(),
+		AppKey:      connect.Session.AppKey(),
+		Username:    &credentials.UserName,
+		Password:    credentials.Password,
+		Compression: connect.OfferedCompressions,
+		MinVersion:  connect.ProtocolVersions.Min,
+		MaxVersion:  connect.ProtocolVersions.Max,
 	}
 
-	mtsLoginByteData, err := json.Marshal(mtsLogin)
+	mtsLoginByteData, err := connect.codec().Marshal(mtsLogin)
+	credentials.Zero()
 	if err != nil {
 		fmt.Println("error in marshalling the mtsLogin Data: ", err)
 		go func() { connect.ErrorChan <- err }()
@@ -159,30 +481,60 @@ func (connect *TCPConnect) loginWithUsernameAndPassword() {
 	}
 
 	mtsLoginMessage := helper.CreateRequest(
+		&connect.RPCIDs,
 		enum.Login,
 		nil,
-		MTSRMSServer,
+		connect.Session.NodeID(),
 		MTSServer,
 		false,
 		nil,
 		mtsLoginByteData,
 	)
 
-	connect.Login(mtsLoginMessage, connect.IsAuthenticated)
+	connect.LoginContext(ctx, mtsLoginMessage, isAuthenticated)
 }
 
 //Login login the user and returns the MtsLoginResponse
 func (connect *TCPConnect) Login(mtsLoginMessage model.MTSMessage, certificateReceived chan bool) {
-	err := connect.SendLoginPayload(mtsLoginMessage, 1000000)
+	connect.LoginContext(context.Background(), mtsLoginMessage, certificateReceived)
+}
+
+//LoginContext sends the login within the context and then keeps reading the connection
+func (connect *TCPConnect) LoginContext(ctx context.Context, mtsLoginMessage model.MTSMessage, certificateReceived chan bool) {
+	_, closer := connect.connection()
+	err := connect.sendLoginPayloadContext(ctx, mtsLoginMessage)
+	//the payload carries the password or the client certificate, do not keep it around
+	wipe(mtsLoginMessage.Data)
 
 	if err != nil {
 		fmt.Println("Error getting the client cert", err)
-		connect.ErrorChan <- err
+		connect.failLogin(err, certificateReceived)
+		return
 	}
 
 	isDone, err := connect.Receieve()
+	closed, failure := closer.state()
+	if failure != nil {
+		//the client dropped the connection, report why rather than the closed connection error
+		err = failure
+	}
+
+	//replies for this connection will never arrive now
+	connect.pending.failAll(fmt.Errorf("%w: %v", ErrConnectionLost, err))
+
+	if closed && failure == nil {
+		//the connection was closed on purpose, after the password login, by Close or by the supervisor
+		fmt.Println("connection closed")
+		return
+	}
+
 	if err != nil {
 		fmt.Println("error reading the data")
+		if connect.awaitingLogin {
+			connect.failLogin(err, certificateReceived)
+			return
+		}
+
 		connect.ErrorChan <- err
 	}
 
@@ -191,38 +543,32 @@ func (connect *TCPConnect) Login(mtsLoginMessage model.MTSMessage, certificateRe
 	}
 }
 
+//failLogin answers a pending login with the transport error that interrupted it
+func (connect *TCPConnect) failLogin(err error, certificateReceived chan bool) {
+	connect.connErr = err
+	connect.awaitingLogin = false
+	certificateReceived <- false
+}
+
 //SendAcknowledgmentToServer sends the ack back to the server
+//it dispatches the message to its handler and returns the error of the first failed reply
 func (connect *TCPConnect) SendAcknowledgmentToServer(mtsMessage *model.MTSMessage) error {
-	strJWT := string(JWT)
-	mtsMessage.JWT = &strJWT
-
-	switch mtsMessage.Route {
-	case enum.OPL:
-		log.Println("OPL response")
-		strOplResponse, _ := json.Marshal(mtsMessage)
-		log.Println("received OPL response: ", strOplResponse)
-		return nil
-	case enum.RMSPing:
-		log.Print("Received RMS Ping request. Sending RMS Ping response.")
-		fmt.Println("JWT Token is : ", mtsMessage.JWT)
-		msgResponse := helper.CreateResponse(mtsMessage, enum.RMSPingResponse, nil, false, mtsMessage.JWT, make([]byte, 4))
-		return connect.SendDataToServer(msgResponse)
-	default:
-		log.Print("Unknown message : ", mtsMessage.Route)
-		var responseMsg = helper.CreateErrorResponse(enum.InvalidRequest, enum.MtsErrorID.String(enum.InvalidRequest), mtsMessage, mtsMessage.Route, nil, mtsMessage.JWT)
-		return connect.SendDataToServer(responseMsg)
-	}
+	responseWriter := &messageResponseWriter{connect: connect, request: mtsMessage}
+	connect.Router.Dispatch(responseWriter, mtsMessage)
+	return responseWriter.err
 }
 
 //SendDataToServer sends the data to MTS Server
 func (connect *TCPConnect) SendDataToServer(mtsMessage model.MTSMessage) error {
+	return connect.SendDataToServerContext(context.Background(), mtsMessage)
+}
 
-	mtsMessageByteData, err := json.Marshal(mtsMessage)
-	if err != nil {
-		fmt.Println("error in marshalling the MTSMessage Data: ", err)
-	}
+//SendDataToServerContext sends the data to MTS Server, DefaultTimeOutMs applies when the context has no deadline
+func (connect *TCPConnect) SendDataToServerContext(ctx context.Context, mtsMessage model.MTSMessage) error {
+	ctx, cancel := connect.withDefaultTimeout(ctx)
+	defer cancel()
 
-	err = connect.send(mtsMessageByteData)
+	err := chainSend(connect.outbound, connect.sendMessage)(ctx, &mtsMessage)
 	if err != nil {
 		fmt.Println(err)
 		return err
@@ -231,7 +577,34 @@ func (connect *TCPConnect) SendDataToServer(mtsMessage model.MTSMessage) error {
 	return nil
 }
 
-func (connect *TCPConnect) send(msg []byte) error {
+//UseOutbound appends middlewares around every outbound message, the first one runs outermost
+func (connect *TCPConnect) UseOutbound(middlewares ...SendMiddleware) {
+	connect.outbound = append(connect.outbound, middlewares...)
+}
+
+//sendMessage is the end of the outbound chain
+func (connect *TCPConnect) sendMessage(ctx context.Context, mtsMessage *model.MTSMessage) error {
+	if !mtsMessage.Reply {
+		//replies keep the version of the request they answer
+		mtsMessage.Version = connect.NegotiatedVersion()
+	}
+
+	mtsMessageByteData, err := connect.codec().Marshal(mtsMessage)
+	if err != nil {
+		fmt.Println("error in marshalling the MTSMessage Data: ", err)
+		return err
+	}
+
+	if mtsMessage.Route == enum.Login {
+		//the login carries the password or the client certificate
+		defer wipe(mtsMessageByteData)
+	}
+
+	return connect.send(ctx, mtsMessage, mtsMessageByteData)
+}
+
+//send frames the encoded message and waits for the writer goroutine, login frames are wiped and never logged
+func (connect *TCPConnect) send(ctx context.Context, mtsMessage *model.MTSMessage, msg []byte) error {
 	defer func() {
 		if r := recover(); r != nil {
 			err := r.(error)
@@ -239,108 +612,221 @@ func (connect *TCPConnect) send(msg []byte) error {
 		}
 	}()
 
-	data := helper.PrepareData(msg)
+	frameWriter := helper.NewFrameWriter()
+	frameWriter.Framer = connect.Framer
+	frameWriter.Compressor = connect.compressor()
+	data, err := frameWriter.PrepareFrame(msg)
+	if err != nil {
+		return fmt.Errorf("Sender: Frame Error: %w", err)
+	}
+
+	secret := mtsMessage.Route == enum.Login
+	if err = connect.checkFrameMTU(mtsMessage, len(data)); err != nil {
+		if secret {
+			wipe(data)
+		}
+		return err
+	}
+
 	//sending message
-	fmt.Println("sender payload json:", string(msg))
-	num, err := connect.WriteToConn(data)
+	fmt.Println("sender payload json:", messageForLog(mtsMessage))
+	err = connect.sendQueue.send(ctx, connect.priorityOf(mtsMessage), data, secret)
+	if ctxErr := helper.ContextError(ctx, err); ctxErr != err {
+		return ctxErr
+	}
+
 	if err != nil {
 		return fmt.Errorf("Sender: Write Error: %w", err)
 	}
 
-	log.Printf("Sender: Wrote %d byte(s)\n", num)
+	log.Printf("Sender: Wrote %d byte(s)\n", len(data))
 	return nil
 }
 
-//WriteToConn writes to connection
+//messageForLog renders the message as JSON with the token masked
+//the payloads of login and communication key routes carry credentials or keys and are left out entirely
+func messageForLog(mtsMessage *model.MTSMessage) string {
+	switch mtsMessage.Route {
+	case enum.Login, enum.LoginResponse, enum.RMSCommunicationKeys, enum.PPCommunicationKeys:
+		return fmt.Sprintf("<%s rpcId %d redacted>", mtsMessage.Route, mtsMessage.RPCID)
+	}
+
+	redacted := *mtsMessage
+	if redacted.JWT != nil {
+		redacted.JWT = helper.StrToPointer("REDACTED")
+	}
+
+	data, err := json.Marshal(&redacted)
+	if err != nil {
+		return fmt.Sprintf("<%s rpcId %d unprintable: %v>", mtsMessage.Route, mtsMessage.RPCID, err)
+	}
+
+	return string(data)
+}
+
+//writeFrame runs on the writer goroutine, a failed write leaves a partial frame on the wire so the connection is dropped
+func (connect *TCPConnect) writeFrame(frame *outboundFrame) error {
+	conn, closer := connect.connection()
+	stop := helper.BindContext(frame.ctx, conn.SetWriteDeadline)
+	_, err := connect.writeTo(conn, frame.data)
+	stop()
+
+	if err != nil {
+		connect.dropConn(closer, err)
+	}
+
+	return err
+}
+
+//WriteToConn writes to connection through a buffered writer that is kept for the lifetime of the connection
 func (connect *TCPConnect) WriteToConn(content []byte) (int, error) {
-	writer := bufio.NewWriterSize(connect.Conn, WriteBufferSize)
-	number, err := writer.Write(content)
+	conn, _ := connect.connection()
+	return connect.writeTo(conn, content)
+}
+
+func (connect *TCPConnect) writeTo(conn net.Conn, content []byte) (int, error) {
+	connect.writerMutex.Lock()
+	defer connect.writerMutex.Unlock()
+
+	if connect.writer == nil {
+		connect.writer = bufio.NewWriterSize(conn, WriteBufferSize)
+		connect.writerConn = conn
+	} else if connect.writerConn != conn {
+		connect.writer.Reset(conn)
+		connect.writerConn = conn
+	}
+
+	number, err := connect.writer.Write(content)
 	if err == nil {
-		err = writer.Flush()
+		err = connect.writer.Flush()
 	}
+
+	if err != nil {
+		//bufio keeps the first error forever, start clean for the next connection
+		connect.writer.Reset(conn)
+	}
+
 	return number, err
 }
 
 // ReadFromConn reads from conn
 func (connect *TCPConnect) ReadFromConn() (bool, error) {
-	size := 100
-	buff := make([]byte, size)
-	reader := bufio.NewReader(connect.Conn)
+	conn, closer := connect.connection()
+	frameReader := helper.NewFrameReader(conn)
+	frameReader.MaxFrameLength = connect.MaxInboundFrameLength
+	frameReader.Framer = connect.Framer
 
-	finalstring := ""
 	for {
-		_, err := io.ReadFull(reader, buff[:size])
+		dataSegment, err := frameReader.ReadFrame()
+		if errors.Is(err, helper.ErrFrameTooLarge) || errors.Is(err, helper.ErrInvalidFrameLength) {
+			//the stream can not be resynchronised after a bad header so drop the connection
+			fmt.Println("rejecting inbound frame: ", err)
+			connect.dropConn(closer, err)
+			return false, err
+		}
+
 		if err != nil {
 			fmt.Println("error occured while reading form the connection")
 			return false, err
 		}
 
-		finalstring = finalstring + string(buff)
-		finalstring = connect.validateServerResponseLength([]byte(finalstring))
-		fmt.Println(finalstring)
+		connect.ProcessDataSegment(dataSegment)
+		//the login response switches the frames that follow it to the negotiated compression
+		frameReader.Compressor = connect.compressor()
 	}
 }
 
-func (connect *TCPConnect) validateServerResponseLength(buff []byte) string {
-	var lengthOfResponseBa []byte
-	lengthOfResponseBa = buff[:4]
+//ProcessDataSegment process this segment asynchronously
+func (connect *TCPConnect) ProcessDataSegment(dataSegment []byte) {
+	mtsResponseMessage := model.MTSMessage{}
+	err := connect.codec().Unmarshal(dataSegment, &mtsResponseMessage)
+	if err != nil {
+		fmt.Println("error occured while unmarshalling datasegment: ", err)
+		return
+	}
 
-	// convert This length Of Response To data length
-	responseLengthInt := helper.ConvertByteToInt(lengthOfResponseBa)
+	fmt.Println("required segement : ", messageForLog(&mtsResponseMessage))
 
-	if len(buff) < responseLengthInt+Offset {
-		return string(buff)
+	if !connect.ProtocolVersions.Contains(mtsResponseMessage.Version) {
+		connect.rejectUnsupportedVersion(&mtsResponseMessage)
+		return
 	}
 
-	dataSegment := buff[Offset : responseLengthInt+Offset]
-	fmt.Println("required segement : ", string(dataSegment))
-	connect.ProcessDataSegment(string(dataSegment))
-
-	remainingData := buff[responseLengthInt+Offset:]
-	fmt.Println("remaining segment : ", string(remainingData))
-	return string(remainingData)
-}
+	if mtsResponseMessage.Reply && connect.pending.resolve(&mtsResponseMessage) {
+		return
+	}
 
-//ProcessDataSegment process this segment asynchronously
-func (connect *TCPConnect) ProcessDataSegment(dataSegmentString string) {
-	mtsResponseMessage := model.MTSMessage{}
-	err := json.Unmarshal([]byte(dataSegmentString), &mtsResponseMessage)
-	if err != nil {
-		fmt.Println("error occured while unmarshalling datasegment: ", err)
+	//the login response switches the reader to the negotiated compression so it is handled before the next read
+	if mtsResponseMessage.Route == enum.LoginResponse {
+		connect.acknowledge(&mtsResponseMessage)
+		return
 	}
 
-	switch mtsResponseMessage.Route {
-	case enum.OPL:
-		fmt.Println("OPL response: ")
-		connect.SendAcknowledgmentToServer(&mtsResponseMessage)
-	case enum.LoginResponse:
-		connect.ExtractCertData(mtsResponseMessage)
-	case enum.RMSPing:
-		connect.SendAcknowledgmentToServer(&mtsResponseMessage)
+	//a handler may Call the server or wait on a full send queue, which would stall the reader that delivers the reply
+	go connect.acknowledge(&mtsResponseMessage)
+}
+
+func (connect *TCPConnect) acknowledge(mtsMessage *model.MTSMessage) {
+	if err := connect.SendAcknowledgmentToServer(mtsMessage); err != nil {
+		fmt.Println("error replying to ", mtsMessage.Route, " rpcId ", mtsMessage.RPCID, ": ", err)
 	}
 }
 
 //ExtractCertData extracts the cert information out of the response
+//a response that arrives while no login is in progress, such as the late reply of a timed out token refresh, is dropped
 func (connect *TCPConnect) ExtractCertData(mtsMessage model.MTSMessage) {
+	if !connect.awaitingLogin {
+		fmt.Println("dropping login response without a pending login, rpcId: ", mtsMessage.RPCID)
+		return
+	}
+
+	connect.awaitingLogin = false
 	mtsResponse := model.MtsLoginResponse{}
 	responseData := mtsMessage.Data
-	err := json.Unmarshal(responseData, &mtsResponse)
+	if mtsMessage.IsError == true {
+		connect.connErr = connect.decodeMtsError(&mtsMessage)
+		fmt.Println("login rejected: ", connect.connErr)
+		connect.IsAuthenticated <- false
+		return
+	}
+
+	err := connect.codec().Unmarshal(responseData, &mtsResponse)
 	if err != nil {
 		fmt.Println("error occuredwhen unmarshalling the response data")
+		connect.connErr = err
 		connect.IsAuthenticated <- false
+		return
 	}
 
-	if mtsMessage.IsError == true {
+	if err = connect.negotiateVersion(mtsResponse.Version); err != nil {
+		fmt.Println("login rejected: ", err)
+		connect.connErr = err
 		connect.IsAuthenticated <- false
+		return
 	}
 
-	ClientCertificate = mtsResponse.ClientCertificate
-	if mtsMessage.JWT != nil {
-		JWT = []byte(*mtsMessage.JWT)
-	} else {
-		JWT = nil
+	if err = connect.negotiateCompression(mtsResponse.Compression); err != nil {
+		fmt.Println("login rejected: ", err)
+		connect.connErr = err
+		connect.IsAuthenticated <- false
+		return
 	}
 
+	connect.Session.setMTU(MTU{Opl: mtsResponse.MtuOpl, Mts: mtsResponse.MtuMts, Bluetooth: mtsResponse.MtuBluetooth})
+
+	if err = connect.Tokens.Set(mtsMessage.JWT); err != nil {
+		fmt.Println("login rejected: ", err)
+		connect.connErr = err
+		connect.IsAuthenticated <- false
+		return
+	}
+
+	//certificate logins may not issue a new certificate, keep the one they logged in with
+	if len(mtsResponse.ClientCertificate) > 0 {
+		connect.Session.SetClientCertificate(mtsResponse.ClientCertificate)
+	}
+
+	connect.sendQueue.release()
 	connect.IsAuthenticated <- true
 }
 
@@ -359,19 +845,40 @@ func (connect *TCPConnect) Receieve() (bool, error) {
 
 //SendLoginPayload sends the data to MTS Client and gets the appropriate response
 func (connect *TCPConnect) SendLoginPayload(mtsMessage model.MTSMessage, timeOutMs int) error {
-	mtsMessageByteData, err := json.Marshal(mtsMessage)
-	if err != nil {
-		fmt.Println("error in marshalling the MTSMessage Data: ", err)
-		return err
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeOutMs)*time.Millisecond)
+	defer cancel()
+
+	return connect.sendLoginPayloadContext(ctx, mtsMessage)
+}
+
+func (connect *TCPConnect) sendLoginPayloadContext(ctx context.Context, mtsMessage model.MTSMessage) error {
+	return connect.SendDataToServerContext(ctx, mtsMessage)
+}
 
-	err = connect.send(mtsMessageByteData)
+//SendWithAttributeRoute sends the payload on enum.UseAttributeRoute without waiting for a reply
+func (connect *TCPConnect) SendWithAttributeRoute(attributeRoute string, payload interface{}) error {
+	return connect.SendWithAttributeRouteContext(context.Background(), attributeRoute, payload)
+}
+
+//SendWithAttributeRouteContext sends the payload on enum.UseAttributeRoute within the context
+func (connect *TCPConnect) SendWithAttributeRouteContext(ctx context.Context, attributeRoute string, payload interface{}) error {
+	data, err := connect.encodePayload(payload)
 	if err != nil {
-		fmt.Println(err)
 		return err
 	}
 
-	return nil
+	mtsMessage := helper.CreateRequest(
+		&connect.RPCIDs,
+		enum.UseAttributeRoute,
+		&attributeRoute,
+		connect.Session.NodeID(),
+		MTSServer,
+		false,
+		nil,
+		data,
+	)
+
+	return connect.SendDataToServerContext(ctx, mtsMessage)
 }
 
 //SendTestOPLPayload sends the test payload to the server
@@ -383,43 +890,20 @@ func (connect *TCPConnect) SendTestOPLPayload() {
 		Data:            make([]byte, 16),
 	}
 
-	strMtsOPLPayload, err := json.Marshal(mtsOPLPayload)
-	if err != nil {
-		fmt.Println("error occured in marshalling the OPLpayload data")
+	if err := connect.SendOPLPayloadContext(context.Background(), enum.OPL, &mtsOPLPayload); err != nil {
 		fmt.Println(err)
 	}
-
-	mtsLoginMessage := helper.CreateRequest(
-		enum.OPL,
-		nil,
-		MTSRMSServer,
-		MTSServer,
-		false,
-		helper.StrToPointer(string(JWT)),
-		strMtsOPLPayload,
-	)
-
-	connect.SendDataToServer(mtsLoginMessage)
 }
 
 //SendMTSOPLPayload sends the OPL payload to the server
 func (connect *TCPConnect) SendMTSOPLPayload(mtsOPLPayload *model.MtsOplPayload) {
-	strMtsOPLPayload, err := json.Marshal(mtsOPLPayload)
-	if err != nil {
-		fmt.Println("error occured in marshalling the OPLpayload data")
-		fmt.Println(err)
+	if err := connect.SendMTSOPLPayloadContext(context.Background(), mtsOPLPayload); err != nil {
+		fmt.Println("error sending the OPL payload: ", err)
 	}
-
-	mtsLoginMessage := helper.CreateRequest(
-		enum.OPL,
-		nil,
-		MTSRMSServer,
-		MTSServer,
-		false,
-		helper.StrToPointer(string(JWT)),
-		strMtsOPLPayload,
-	)
-
-	connect.SendDataToServer(mtsLoginMessage)
 	connect.Wg.Done()
 }
+
+//SendMTSOPLPayloadContext sends the OPL payload to the server within the context, Data over MtuOpl is rejected with an MTUError
+func (connect *TCPConnect) SendMTSOPLPayloadContext(ctx context.Context, mtsOPLPayload *model.MtsOplPayload) error {
+	return connect.SendOPLPayloadContext(ctx, enum.OPL, mtsOPLPayload)
+}
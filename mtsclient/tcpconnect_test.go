@@ -0,0 +1,62 @@
+package mtsclient
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+)
+
+//TestSendWhileReconnecting is meant for go test -race, it swaps the connection under senders that keep writing
+func TestSendWhileReconnecting(t *testing.T) {
+	server := newLoginServer(t)
+	connect := server.client("alice", RMSIntegratorIdentity())
+	defer connect.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if err := connect.ConnectAndLoginContext(ctx); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				//sends fail while the connection is down, only the wire order and the race detector matter here
+				sendCtx, sendCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+				request := helper.CreateRequest(&connect.RPCIDs, enum.OPL, nil, connect.Session.NodeID(), MTSServer, false, nil, []byte(`{}`))
+				connect.SendDataToServerContext(sendCtx, request)
+				sendCancel()
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		connect.closeConn()
+		if err := connect.reconnectWithCertificate(ctx); err != nil {
+			close(stop)
+			wg.Wait()
+			t.Fatalf("reconnect %d: %v", i, err)
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	if frames := server.framesAheadOfLogin(); frames > 0 {
+		t.Fatalf("%d frames reached the server ahead of the login", frames)
+	}
+}
@@ -0,0 +1,201 @@
+package mtsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//ErrNoClientCertificate is returned when the token has to be refreshed before a certificate was issued
+var ErrNoClientCertificate = errors.New("no client certificate to refresh the token with")
+
+const (
+	//DefaultTokenRefreshBefore is how long before exp the certificate login is re-run
+	DefaultTokenRefreshBefore = time.Minute
+	//tokenRetryInterval spaces the refresh attempts after a failed one
+	tokenRetryInterval = 5 * time.Second
+)
+
+//TokenManager swaps the session JWT atomically and refreshes it before it expires
+type TokenManager struct {
+	//RefreshBefore is how long before exp the token is refreshed, capped at half the token lifetime
+	RefreshBefore time.Duration
+	//VerificationKey verifies the token signature when set, see helper.ParseJWT for the key types
+	VerificationKey interface{}
+	connect         *TCPConnect
+	//updated wakes Run whenever a new token is stored
+	updated      chan struct{}
+	refreshMutex sync.Mutex
+}
+
+//newTokenManager is the ctor for the manager of the client's session token
+func newTokenManager(connect *TCPConnect) *TokenManager {
+	tokens := &TokenManager{
+		RefreshBefore: DefaultTokenRefreshBefore,
+		connect:       connect,
+		updated:       make(chan struct{}, 1),
+	}
+	return tokens
+}
+
+//Current returns the token outbound messages carry, nil before the first login
+func (tokens *TokenManager) Current() *helper.JWTClaims {
+	return tokens.connect.Session.JWT()
+}
+
+//Set parses the token from a login response and swaps it in, an empty token clears it
+//without a VerificationKey a token that is not a JWT is kept as an opaque token that is never refreshed ahead of time
+func (tokens *TokenManager) Set(raw *string) error {
+	if raw == nil || *raw == "" {
+		tokens.store(nil)
+		return nil
+	}
+
+	claims, err := helper.ParseJWT(*raw, tokens.VerificationKey)
+	if errors.Is(err, helper.ErrMalformedJWT) && tokens.VerificationKey == nil {
+		fmt.Println("session token has no readable claims: ", err)
+		claims, err = &helper.JWTClaims{Raw: *raw}, nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	tokens.store(claims)
+	return nil
+}
+
+func (tokens *TokenManager) store(claims *helper.JWTClaims) {
+	tokens.connect.Session.setJWT(claims)
+
+	select {
+	case tokens.updated <- struct{}{}:
+	default:
+	}
+}
+
+//Run refreshes the token ahead of every expiry until the context is done
+func (tokens *TokenManager) Run(ctx context.Context) error {
+	for {
+		stale := tokens.Current()
+		if stale == nil || stale.ExpiresAt.IsZero() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-tokens.updated:
+			}
+			continue
+		}
+
+		timer := time.NewTimer(time.Until(tokens.refreshAt(stale)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-tokens.updated:
+			timer.Stop()
+		case <-timer.C:
+			if err := tokens.refresh(ctx, stale); err != nil {
+				fmt.Println("token refresh failed: ", err)
+				tokens.waitForRetry(ctx)
+			}
+		}
+	}
+}
+
+//waitForRetry spaces failed refreshes, a token stored by a relogin ends the wait early
+func (tokens *TokenManager) waitForRetry(ctx context.Context) {
+	timer := time.NewTimer(tokenRetryInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-tokens.updated:
+		//put the wakeup back so Run reschedules for the new token
+		tokens.store(tokens.Current())
+	case <-timer.C:
+	}
+}
+
+func (tokens *TokenManager) refreshAt(claims *helper.JWTClaims) time.Time {
+	refreshAt := claims.ExpiresAt.Add(-tokens.RefreshBefore)
+	if !claims.IssuedAt.IsZero() {
+		if halfLife := claims.IssuedAt.Add(claims.ExpiresAt.Sub(claims.IssuedAt) / 2); refreshAt.Before(halfLife) {
+			refreshAt = halfLife
+		}
+	}
+
+	return refreshAt
+}
+
+//Refresh re-runs the certificate login on the open connection and swaps in the token it returns
+func (tokens *TokenManager) Refresh(ctx context.Context) error {
+	return tokens.refresh(ctx, tokens.Current())
+}
+
+//refresh skips the login when another caller already replaced the stale token
+func (tokens *TokenManager) refresh(ctx context.Context, stale *helper.JWTClaims) error {
+	tokens.refreshMutex.Lock()
+	defer tokens.refreshMutex.Unlock()
+
+	if tokens.Current() != stale {
+		return nil
+	}
+
+	connect := tokens.connect
+	certificate := connect.Session.ClientCertificate()
+	if len(certificate) == 0 {
+		return ErrNoClientCertificate
+	}
+
+	mtsLogin := model.MtsLogin{
+		AppID:             connect.Session.AppID(),
+		AppKey:            connect.Session.AppKey(),
+		ClientCertificate: certificate,
+		MinVersion:        connect.NegotiatedVersion(),
+		MaxVersion:        connect.NegotiatedVersion(),
+	}
+	//keep the server on the compression the connection already uses
+	if compressor := connect.compressor(); compressor != nil {
+		mtsLogin.Compression = []string{compressor.Name()}
+	}
+
+	reply, err := connect.Call(ctx, enum.Login, mtsLogin)
+	if err != nil {
+		return err
+	}
+
+	mtsResponse := model.MtsLoginResponse{}
+	if err = connect.codec().Unmarshal(reply.Data, &mtsResponse); err != nil {
+		return err
+	}
+
+	if err = tokens.Set(reply.JWT); err != nil {
+		return err
+	}
+
+	connect.Session.setMTU(MTU{Opl: mtsResponse.MtuOpl, Mts: mtsResponse.MtuMts, Bluetooth: mtsResponse.MtuBluetooth})
+
+	if len(mtsResponse.ClientCertificate) > 0 {
+		connect.Session.SetClientCertificate(mtsResponse.ClientCertificate)
+		connect.saveCertificate(ctx, mtsResponse.ClientCertificate)
+	}
+
+	return nil
+}
+
+//currentJWT is the token InjectJWT stamps on outbound messages
+func (connect *TCPConnect) currentJWT() *string {
+	claims := connect.Tokens.Current()
+	if claims == nil {
+		return nil
+	}
+
+	return helper.StrToPointer(claims.Raw)
+}
@@ -0,0 +1,82 @@
+package mtsclient
+
+import (
+	"fmt"
+
+	"github.com/niroopreddym/custom-tcpprotocol-go/codec"
+	"github.com/niroopreddym/custom-tcpprotocol-go/enum"
+	helper "github.com/niroopreddym/custom-tcpprotocol-go/helpers"
+	"github.com/niroopreddym/custom-tcpprotocol-go/model"
+)
+
+//NegotiatedVersion is the MTSMessage version the server picked at the last login
+//it is helper.ProtocolVersion1 until a login response arrives
+func (connect *TCPConnect) NegotiatedVersion() byte {
+	connect.connMutex.RLock()
+	defer connect.connMutex.RUnlock()
+
+	if connect.protocolVersion == 0 {
+		return helper.ProtocolVersion1
+	}
+
+	return connect.protocolVersion
+}
+
+//codec is the codec for the negotiated version, VersionCodecs overrides Codec per version
+func (connect *TCPConnect) codec() codec.Codec {
+	if messageCodec, ok := connect.VersionCodecs[connect.NegotiatedVersion()]; ok {
+		return messageCodec
+	}
+
+	return connect.Codec
+}
+
+//negotiateVersion records the server's choice, a version the client never advertised fails the login
+func (connect *TCPConnect) negotiateVersion(version byte) error {
+	if version == 0 {
+		version = helper.ProtocolVersion1
+	}
+
+	if !connect.ProtocolVersions.Contains(version) {
+		return &MtsError{
+			ID:      enum.InvalidFormat,
+			Message: fmt.Sprintf("server picked version %d, client speaks %d to %d", version, connect.ProtocolVersions.Min, connect.ProtocolVersions.Max),
+			Route:   enum.LoginResponse,
+		}
+	}
+
+	connect.connMutex.Lock()
+	connect.protocolVersion = version
+	connect.connMutex.Unlock()
+	return nil
+}
+
+//rejectUnsupportedVersion answers a message in a version the client does not speak with InvalidFormat
+func (connect *TCPConnect) rejectUnsupportedVersion(mtsMessage *model.MTSMessage) {
+	mtsError := &MtsError{
+		ID:      enum.InvalidFormat,
+		Message: fmt.Sprintf("unsupported message version %d", mtsMessage.Version),
+		Route:   mtsMessage.Route,
+		RPCID:   mtsMessage.RPCID,
+	}
+	fmt.Println("rejecting inbound message: ", mtsError)
+
+	if mtsMessage.Reply {
+		if connect.pending.fail(mtsMessage.RPCID, mtsError) {
+			return
+		}
+
+		if mtsMessage.Route == enum.LoginResponse && connect.awaitingLogin {
+			connect.awaitingLogin = false
+			connect.connErr = mtsError
+			connect.IsAuthenticated <- false
+		}
+		return
+	}
+
+	errorResponse := helper.CreateErrorResponse(connect.codec(), enum.InvalidFormat, mtsError.Message, mtsMessage, mtsMessage.Route, mtsMessage.AttributeRoute, nil)
+	errorResponse.Version = connect.NegotiatedVersion()
+	if err := connect.SendDataToServer(errorResponse); err != nil {
+		fmt.Println("error rejecting the message version: ", err)
+	}
+}